@@ -0,0 +1,339 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"snail-installer/logic"
+	"snail-installer/utils"
+	"strings"
+)
+
+const asarUsage = `usage: snail-installer asar ls <file> [path]       list what's in an archive, or below path
+       snail-installer asar cat <file> <path>     print a file from an archive
+       snail-installer asar diff <old> <new>      compare two archives, with text diffs of js files
+                          [--no-text]
+       snail-installer asar verify <file>         check the header, offsets and integrity hashes
+
+a file can also be a backup id from snail-installer backups list.
+`
+
+// files diff shows the changes of, not only that they changed
+var textExtensions = map[string]bool{".js": true, ".cjs": true, ".mjs": true, ".json": true}
+
+func runAsar(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, asarUsage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "ls":
+		return runAsarLs(args[1:])
+	case "cat":
+		return runAsarCat(args[1:])
+	case "diff":
+		return runAsarDiff(args[1:])
+	case "verify":
+		return runAsarVerify(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, asarUsage)
+		return exitUsage
+	}
+}
+
+// openAsarArg opens an asar file, a backup or a backup id. backups are put
+// back together in a temp file first, done closes everything and removes it
+func openAsarArg(arg string) (archive *utils.AsarArchive, done func(), err error) {
+	path, cleanup, err := asarArgPath(arg)
+	if err != nil {
+		return nil, nil, err
+	}
+	archive, err = utils.OpenAsar(path)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return archive, func() {
+		archive.Close()
+		cleanup()
+	}, nil
+}
+
+func asarArgPath(arg string) (string, func(), error) {
+	path := arg
+	if _, err := os.Stat(arg); err != nil {
+		if path = findBackup(arg); path == "" {
+			return "", nil, err
+		}
+	}
+	if filepath.Ext(path) != ".json" {
+		return path, func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "snail-backup-*.asar")
+	if err != nil {
+		return "", nil, err
+	}
+	tmp.Close()
+	if err := logic.ExportBackup(path, tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, err
+	}
+	return tmp.Name(), func() { os.Remove(tmp.Name()) }, nil
+}
+
+type asarEntryInfo struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Dir        bool   `json:"dir,omitempty"`
+	Unpacked   bool   `json:"unpacked,omitempty"`
+	Executable bool   `json:"executable,omitempty"`
+	Link       string `json:"link,omitempty"`
+	SHA256     string `json:"sha256,omitempty"` // from the header, when it has integrity
+}
+
+func runAsarLs(args []string) int {
+	fs, out := newFlagSet("asar ls")
+	positional, ok := parse(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return out.fail(exitUsage, errors.New("asar ls takes a file and optionally a path inside it"))
+	}
+
+	archive, done, err := openAsarArg(positional[0])
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	defer done()
+
+	root, prefix := archive.Root, ""
+	if len(positional) == 2 {
+		prefix = strings.Trim(path.Clean("/"+positional[1]), "/")
+		if root = archive.Find(prefix); root == nil {
+			return out.fail(exitError, fmt.Errorf("%s not found in %s", prefix, positional[0]))
+		}
+		if prefix != "" {
+			prefix += "/"
+		}
+	}
+
+	list := []asarEntryInfo{}
+	add := func(p string, e *utils.AsarEntry) error {
+		info := asarEntryInfo{Path: p, Size: e.Size, Dir: e.IsDir, Unpacked: e.Unpacked, Executable: e.Executable, Link: e.Link}
+		if e.Integrity != nil {
+			info.SHA256 = e.Integrity.Hash
+		}
+		list = append(list, info)
+		return nil
+	}
+	if root.IsDir {
+		root.Walk(func(p string, e *utils.AsarEntry) error { return add(prefix+p, e) })
+	} else {
+		add(root.Path(), root)
+	}
+
+	var human strings.Builder
+	for _, e := range list {
+		flags := ""
+		for _, f := range []struct {
+			set  bool
+			flag string
+		}{{e.Dir, "d"}, {e.Unpacked, "u"}, {e.Executable, "x"}, {e.Link != "", "l"}} {
+			if f.set {
+				flags += f.flag
+			}
+		}
+		name := e.Path
+		if e.Link != "" {
+			name += " -> " + e.Link
+		}
+		if e.Dir {
+			fmt.Fprintf(&human, "%10s  %-3s %s/\n", "", flags, name)
+		} else {
+			fmt.Fprintf(&human, "%10d  %-3s %s\n", e.Size, flags, name)
+		}
+	}
+	return out.ok(list, strings.TrimRight(human.String(), "\n"))
+}
+
+func runAsarCat(args []string) int {
+	fs, out := newFlagSet("asar cat")
+	positional, ok := parse(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) != 2 {
+		return out.fail(exitUsage, errors.New("asar cat takes a file and a path inside it"))
+	}
+
+	archive, done, err := openAsarArg(positional[0])
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	defer done()
+
+	data, err := archive.ReadAnyFile(strings.TrimPrefix(positional[1], "/"))
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	if out.json {
+		return out.ok(map[string]any{"path": positional[1], "size": len(data), "content": string(data)}, "")
+	}
+	// as is, no newline added
+	os.Stdout.Write(data)
+	return exitOK
+}
+
+type asarDiffEntry struct {
+	utils.AsarChange
+	Diff string `json:"diff,omitempty"`
+}
+
+func runAsarDiff(args []string) int {
+	fs, out := newFlagSet("asar diff")
+	noText := fs.Bool("no-text", false, "only list what changed")
+	positional, ok := parse(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) != 2 {
+		return out.fail(exitUsage, errors.New("asar diff takes two files"))
+	}
+
+	oldArchive, oldDone, err := openAsarArg(positional[0])
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	defer oldDone()
+	newArchive, newDone, err := openAsarArg(positional[1])
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	defer newDone()
+
+	changes, err := utils.DiffAsar(oldArchive, newArchive)
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+
+	list := []asarDiffEntry{}
+	var human strings.Builder
+	for _, c := range changes {
+		entry := asarDiffEntry{AsarChange: c}
+		switch c.Kind {
+		case utils.AsarAdded:
+			fmt.Fprintf(&human, "+ %s (%s, %s)\n", c.Path, formatSize(c.NewSize), shortHash(c.NewHash))
+		case utils.AsarRemoved:
+			fmt.Fprintf(&human, "- %s (%s, %s)\n", c.Path, formatSize(c.OldSize), shortHash(c.OldHash))
+		case utils.AsarChanged:
+			fmt.Fprintf(&human, "~ %s (%s, %s -> %s, %s)\n", c.Path, formatSize(c.OldSize), shortHash(c.OldHash), formatSize(c.NewSize), shortHash(c.NewHash))
+		}
+
+		if !*noText && textExtensions[path.Ext(c.Path)] {
+			entry.Diff = textDiff(oldArchive, newArchive, c)
+			if entry.Diff != "" {
+				human.WriteString(entry.Diff)
+			}
+		}
+		list = append(list, entry)
+	}
+	if len(list) == 0 {
+		human.WriteString("no differences")
+	}
+	return out.ok(list, strings.TrimRight(human.String(), "\n"))
+}
+
+// textDiff diffs one changed js file, an added or removed one is diffed
+// against nothing
+func textDiff(oldArchive, newArchive *utils.AsarArchive, c utils.AsarChange) string {
+	var oldData, newData []byte
+	var err error
+	oldName, newName := "a/"+c.Path, "b/"+c.Path
+	if c.Kind == utils.AsarAdded {
+		oldName = "/dev/null"
+	} else if oldData, err = oldArchive.ReadAnyFile(c.Path); err != nil {
+		return ""
+	}
+	if c.Kind == utils.AsarRemoved {
+		newName = "/dev/null"
+	} else if newData, err = newArchive.ReadAnyFile(c.Path); err != nil {
+		return ""
+	}
+
+	diff, ok := utils.DiffText(oldName, newName, oldData, newData)
+	if !ok {
+		return "  (too many changes to show)\n"
+	}
+	return diff
+}
+
+func runAsarVerify(args []string) int {
+	fs, out := newFlagSet("asar verify")
+	positional, ok := parse(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		return out.fail(exitUsage, errors.New("asar verify takes exactly one file"))
+	}
+
+	path, done, err := asarArgPath(positional[0])
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	defer done()
+
+	// backups never have the .unpacked folder
+	problems, err := utils.VerifyAsar(path, utils.VerifyOptions{SkipUnpacked: path != positional[0]})
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	result := map[string]any{"file": positional[0], "problems": problems}
+	if len(problems) == 0 {
+		result["problems"] = []utils.AsarProblem{}
+		return out.ok(result, positional[0]+" looks fine")
+	}
+
+	err = fmt.Errorf("%s has %d problem(s)", positional[0], len(problems))
+	if out.json {
+		enc := json.NewEncoder(out.w)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]any{"ok": false, "error": err.Error(), "result": result})
+		return exitError
+	}
+	out.fail(exitError, err)
+	for _, p := range problems {
+		if p.Path == "" {
+			fmt.Fprintf(os.Stderr, "  %s\n", p.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", p.Path, p.Message)
+		}
+	}
+	return exitError
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func shortHash(sum string) string {
+	if len(sum) > 12 {
+		return sum[:12]
+	}
+	if sum == "" {
+		return "no hash"
+	}
+	return sum
+}
@@ -0,0 +1,472 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"snail-installer/logic"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ncruces/zenity"
+)
+
+// exit codes
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitUsage        = 2
+	exitNotInstalled = 3 // status: slack is there but snail isn't
+)
+
+const usage = `usage: snail-installer <command> [flags]
+
+commands:
+  install     [--slack-path PATH] [--server-url URL]   patch slack
+              [--bundle ZIP]                           offline, from a snail bundle
+  uninstall   [--slack-path PATH] [--remove-data]      remove snail from slack
+  status      [--slack-path PATH]                      show what is installed and what's wrong
+  watch       [--repatch] [--quiet]                    wait for slack updates that remove snail
+  backups list                                         list app.asar backups
+  backups verify                                       check every backup against its hash
+  restore     [--slack-path PATH] <backup id|path>     put a backup back
+  asar        ls|cat|diff|verify <file> ...            look inside asar archives, see snail-installer asar
+  plugins     ls|enable|disable|install|remove ...     manage plugins and themes, see snail-installer plugins
+
+--slack-path can be left out when there is exactly one Slack install to find.
+
+every command takes --json to print machine readable output on stdout.
+logs always go to stderr.
+
+exit codes: 0 ok, 1 failed, 2 bad usage, 3 (status) snail not installed
+`
+
+// Run handles a command line and returns the process exit code
+func Run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "install":
+		return runInstall(args[1:])
+	case "uninstall":
+		return runUninstall(args[1:])
+	case "status":
+		return runStatus(args[1:])
+	case "watch":
+		return runWatch(args[1:])
+	case "backups":
+		return runBackups(args[1:])
+	case "restore":
+		return runRestore(args[1:])
+	case "asar":
+		return runAsar(args[1:])
+	case "plugins":
+		return runPlugins(args[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+}
+
+type output struct {
+	json bool
+	w    io.Writer
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *output) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	out := &output{w: os.Stdout}
+	fs.BoolVar(&out.json, "json", false, "print json on stdout")
+	return fs, out
+}
+
+// parse allows flags after positional arguments too, and returns the
+// positional ones. false means the flag package already printed why.
+func parse(fs *flag.FlagSet, args []string) ([]string, bool) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, false
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, true
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (o *output) ok(v any, human string) int {
+	if o.json {
+		enc := json.NewEncoder(o.w)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]any{"ok": true, "result": v})
+	} else if human != "" {
+		fmt.Fprintln(o.w, human)
+	}
+	return exitOK
+}
+
+func (o *output) fail(code int, err error) int {
+	if o.json {
+		enc := json.NewEncoder(o.w)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]any{"ok": false, "error": err.Error()})
+	} else {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+	return code
+}
+
+var errNoSlackPath = errors.New("--slack-path is required, no Slack install was found")
+
+// resolveSlackPath falls back to the Slack install we can find when
+// --slack-path wasn't given, as long as there is only one of them
+func resolveSlackPath(path *string) error {
+	if *path != "" {
+		return nil
+	}
+
+	installs := logic.DiscoverSlackInstalls()
+	switch len(installs) {
+	case 0:
+		return errNoSlackPath
+	case 1:
+		fmt.Fprintln(os.Stderr, "using Slack at", installs[0].Path)
+		*path = installs[0].Path
+		return nil
+	}
+
+	var paths []string
+	for _, install := range installs {
+		paths = append(paths, install.Path)
+	}
+	return fmt.Errorf("found more than one Slack install, pick one with --slack-path: %s", strings.Join(paths, ", "))
+}
+
+func runInstall(args []string) int {
+	fs, out := newFlagSet("install")
+	slackPath := fs.String("slack-path", "", "path to the Slack app")
+	serverURL := fs.String("server-url", "", "snail asset server (defaults to the saved setting)")
+	bundlePath := fs.String("bundle", "", "install offline from a snail bundle zip")
+	if _, ok := parse(fs, args); !ok {
+		return exitUsage
+	}
+	if err := resolveSlackPath(slackPath); err != nil {
+		return out.fail(exitUsage, err)
+	}
+
+	if *serverURL != "" {
+		// the installer appends "assets/..." to it
+		logic.AppSettings.ServerURL = strings.TrimSuffix(*serverURL, "/") + "/"
+	}
+
+	err := logic.InstallSomething(logic.InstallOptions{
+		TargetPath: *slackPath,
+		BundlePath: *bundlePath,
+	})
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	return out.ok(map[string]string{"slackPath": *slackPath}, "snail installed \\o/")
+}
+
+func runUninstall(args []string) int {
+	fs, out := newFlagSet("uninstall")
+	slackPath := fs.String("slack-path", "", "path to the Slack app")
+	removeData := fs.Bool("remove-data", false, "also delete plugins, themes and backups in ~/.snail")
+	if _, ok := parse(fs, args); !ok {
+		return exitUsage
+	}
+	if err := resolveSlackPath(slackPath); err != nil {
+		return out.fail(exitUsage, err)
+	}
+
+	err := logic.Uninstall(logic.UninstallOptions{
+		TargetPath:     *slackPath,
+		RemoveUserData: *removeData,
+	})
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	return out.ok(map[string]string{"slackPath": *slackPath}, "snail removed from slack")
+}
+
+func runStatus(args []string) int {
+	fs, out := newFlagSet("status")
+	slackPath := fs.String("slack-path", "", "path to the Slack app")
+	if _, ok := parse(fs, args); !ok {
+		return exitUsage
+	}
+	if err := resolveSlackPath(slackPath); err != nil {
+		return out.fail(exitUsage, err)
+	}
+
+	report, err := logic.Status(*slackPath)
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+
+	var human strings.Builder
+	fmt.Fprintf(&human, "slack:     %s %s\n", report.SlackPath, report.SlackVersion)
+	fmt.Fprintf(&human, "app.asar:  %s\n", report.AsarPath)
+	fmt.Fprintf(&human, "snail:     %s\n", report.Summary())
+	if report.PatchStrategy != "" {
+		fmt.Fprintf(&human, "strategy:  %s\n", report.PatchStrategy)
+	}
+	if report.CodeSignatureValid != nil {
+		fmt.Fprintf(&human, "codesign:  %s\n", map[bool]string{true: "valid", false: "broken"}[*report.CodeSignatureValid])
+	}
+	for _, file := range report.Loader {
+		state := "missing"
+		if file.Exists {
+			state = "ok"
+			if file.Version != "" {
+				state += ", from " + file.Version
+			}
+		}
+		fmt.Fprintf(&human, "%-10s %s (%s)\n", file.Name+":", file.Path, state)
+	}
+	fmt.Fprintf(&human, "loader:    %s (server has %s)\n", orUnknown(report.LoaderVersion), orUnknown(report.ServerVersion))
+	fmt.Fprintf(&human, "enabled:   %d plugins, %d themes\n", report.PluginsEnabled, report.ThemesEnabled)
+	if len(report.Fuses) > 0 {
+		names := make([]string, 0, len(report.Fuses))
+		for name := range report.Fuses {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		human.WriteString("fuses:\n")
+		for _, name := range names {
+			fmt.Fprintf(&human, "  %s: %s\n", name, report.Fuses[name])
+		}
+	}
+	if len(report.Problems) > 0 {
+		human.WriteString("problems:\n")
+		for _, problem := range report.Problems {
+			fmt.Fprintf(&human, "  - %s\n", problem.Message)
+		}
+	}
+
+	out.ok(report, strings.TrimRight(human.String(), "\n"))
+	if !report.Installed {
+		return exitNotInstalled
+	}
+	return exitOK
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+type watchEvent struct {
+	Event     string `json:"event"`
+	SlackPath string `json:"slackPath"`
+	Version   string `json:"version"`
+	Error     string `json:"error,omitempty"`
+}
+
+func runWatch(args []string) int {
+	fs, out := newFlagSet("watch")
+	repatch := fs.Bool("repatch", false, "install snail again right away instead of only telling")
+	quiet := fs.Bool("quiet", false, "no desktop notifications")
+	if _, ok := parse(fs, args); !ok {
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := logic.Watch(logic.WatchOptions{
+		Context: ctx,
+		Repatch: *repatch,
+		Notify: func(ev logic.WatchEvent) {
+			var text string
+			switch ev.Kind {
+			case logic.WatchPatchLost:
+				text = fmt.Sprintf("Slack %s removed snail from %s", ev.Install.Version, ev.Install.Path)
+				if !*repatch {
+					text += ", run snail-installer install to get it back"
+				}
+			case logic.WatchRepatched:
+				text = fmt.Sprintf("snail is back in Slack %s", ev.Install.Version)
+			case logic.WatchRepatchFailed:
+				text = fmt.Sprintf("could not put snail back into Slack %s: %s", ev.Install.Version, ev.Err)
+			}
+
+			// one json object per line, watch never ends with a single result
+			if out.json {
+				line := watchEvent{Event: ev.Kind.String(), SlackPath: ev.Install.Path, Version: ev.Install.Version}
+				if ev.Err != nil {
+					line.Error = ev.Err.Error()
+				}
+				json.NewEncoder(out.w).Encode(line)
+			} else {
+				fmt.Fprintln(out.w, text)
+			}
+			if !*quiet {
+				zenity.Notify(text, zenity.Title("snail"))
+			}
+		},
+	})
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	return exitOK
+}
+
+type backupInfo struct {
+	ID               string `json:"id"`
+	Path             string `json:"path"`
+	Time             string `json:"time"`
+	SlackVersion     string `json:"slackVersion,omitempty"`
+	Pristine         *bool  `json:"pristine,omitempty"` // unknown for backups without metadata
+	Size             int64  `json:"size,omitempty"`
+	SHA256           string `json:"sha256,omitempty"`
+	InstallerVersion string `json:"installerVersion,omitempty"`
+	Corrupt          string `json:"corrupt,omitempty"`
+}
+
+func listBackups() []backupInfo {
+	backups := logic.GetBackupList()
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+
+	list := []backupInfo{}
+	for _, b := range backups {
+		info := backupInfo{
+			ID:      strings.TrimSuffix(filepath.Base(b.Filepath), filepath.Ext(b.Filepath)),
+			Path:    b.Filepath,
+			Time:    b.Time.Format(time.RFC3339),
+			Corrupt: b.Corrupt,
+		}
+		if b.Meta != nil {
+			info.SlackVersion = b.Meta.SlackVersion
+			info.Pristine = &b.Meta.Pristine
+			info.Size = b.Meta.Size
+			info.SHA256 = b.Meta.SHA256
+			info.InstallerVersion = b.Meta.InstallerVersion
+		}
+		list = append(list, info)
+	}
+	return list
+}
+
+// findBackup returns the path of the backup with an id, "" if there's none
+func findBackup(id string) string {
+	for _, b := range listBackups() {
+		if b.ID == id {
+			return b.Path
+		}
+	}
+	return ""
+}
+
+const backupsUsage = "usage: snail-installer backups list [--json]\n       snail-installer backups verify [--json]\n"
+
+func runBackups(args []string) int {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "verify") {
+		fmt.Fprint(os.Stderr, backupsUsage)
+		return exitUsage
+	}
+
+	fs, out := newFlagSet("backups " + args[0])
+	if _, ok := parse(fs, args[1:]); !ok {
+		return exitUsage
+	}
+
+	list := listBackups()
+
+	if args[0] == "verify" {
+		// reads every backup in full, list only looks at sizes
+		bad := 0
+		for i := range list {
+			if err := logic.VerifyBackup(list[i].Path); err != nil {
+				list[i].Corrupt = err.Error()
+			}
+			if list[i].Corrupt != "" {
+				bad++
+			}
+		}
+		if bad > 0 {
+			out.fail(exitError, fmt.Errorf("%d of %d backups are corrupt", bad, len(list)))
+			if !out.json {
+				for _, b := range list {
+					if b.Corrupt != "" {
+						fmt.Fprintf(os.Stderr, "  %s: %s\n", b.ID, b.Corrupt)
+					}
+				}
+			}
+			return exitError
+		}
+		return out.ok(list, fmt.Sprintf("all %d backups are fine", len(list)))
+	}
+
+	var human strings.Builder
+	if len(list) == 0 {
+		human.WriteString("no backups found")
+	}
+	if logical, onDisk, err := logic.BackupUsage(); err == nil && len(list) > 0 {
+		fmt.Fprintf(&human, "%d backups, %.1f MB of app.asar in %.1f MB on disk\n", len(list), float64(logical)/(1<<20), float64(onDisk)/(1<<20))
+	}
+	for _, b := range list {
+		fmt.Fprintf(&human, "%s  %s", b.ID, b.Time)
+		if b.SlackVersion != "" {
+			fmt.Fprintf(&human, "  slack %s", b.SlackVersion)
+		}
+		if b.Pristine != nil && !*b.Pristine {
+			human.WriteString("  (patched)")
+		}
+		if b.Corrupt != "" {
+			fmt.Fprintf(&human, "  CORRUPT: %s", b.Corrupt)
+		}
+		human.WriteString("\n")
+	}
+	return out.ok(list, strings.TrimRight(human.String(), "\n"))
+}
+
+func runRestore(args []string) int {
+	fs, out := newFlagSet("restore")
+	slackPath := fs.String("slack-path", "", "path to the Slack app")
+	positional, ok := parse(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	if err := resolveSlackPath(slackPath); err != nil {
+		return out.fail(exitUsage, err)
+	}
+	if len(positional) != 1 {
+		return out.fail(exitUsage, errors.New("restore takes exactly one backup id or path"))
+	}
+
+	src := positional[0]
+	if _, err := os.Stat(src); err != nil {
+		// not a file, look it up by id
+		if src = findBackup(positional[0]); src == "" {
+			return out.fail(exitError, fmt.Errorf("no backup with id %q, see snail-installer backups list", positional[0]))
+		}
+	}
+
+	err := logic.RestoreBackup(src, *slackPath)
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	return out.ok(map[string]string{"restored": src, "slackPath": *slackPath}, "restored "+src)
+}
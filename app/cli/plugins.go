@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"snail-installer/plugins"
+	"strings"
+)
+
+const pluginsUsage = `usage: snail-installer plugins ls                    list installed plugins
+       snail-installer plugins enable <id>           load a plugin when slack starts
+       snail-installer plugins disable <id>          stop loading it, e.g. when it crashes slack
+       snail-installer plugins install <zip>         install plugins from a zip
+                          [--enable]
+       snail-installer plugins remove <id>           delete a plugin
+
+every command takes --themes to work on themes instead.
+changes apply the next time slack starts.
+`
+
+func runPlugins(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, pluginsUsage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "ls", "list":
+		return runPluginsLs(args[1:])
+	case "enable", "disable", "remove":
+		return runPluginsChange(args[0], args[1:])
+	case "install":
+		return runPluginsInstall(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, pluginsUsage)
+		return exitUsage
+	}
+}
+
+// pluginsFlagSet is newFlagSet with --themes, kind says which one was picked
+// once the flags are parsed
+func pluginsFlagSet(name string) (*flag.FlagSet, *output, func() plugins.Kind) {
+	fs, out := newFlagSet("plugins " + name)
+	themes := fs.Bool("themes", false, "themes instead of plugins")
+	return fs, out, func() plugins.Kind {
+		if *themes {
+			return plugins.Theme
+		}
+		return plugins.Plugin
+	}
+}
+
+func runPluginsLs(args []string) int {
+	fs, out, kindFlag := pluginsFlagSet("ls")
+	positional, ok := parse(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) != 0 {
+		return out.fail(exitUsage, errors.New("plugins ls takes no arguments"))
+	}
+	kind := kindFlag()
+
+	items, err := plugins.List(kind)
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+
+	var human strings.Builder
+	if len(items) == 0 {
+		dir, _ := plugins.Dir(kind)
+		fmt.Fprintf(&human, "no %ss in %s", kind, dir)
+	}
+	for _, item := range items {
+		mark := "[ ]"
+		if item.Enabled {
+			mark = "[x]"
+		}
+		fmt.Fprintf(&human, "%s %s  %s %s", mark, item.ID, item.Name, item.Version)
+		if author := item.AuthorName(); author != "" {
+			fmt.Fprintf(&human, " by %s", author)
+		}
+		human.WriteString("\n")
+		if item.Description != "" {
+			fmt.Fprintf(&human, "    %s\n", item.Description)
+		}
+	}
+	if items == nil {
+		items = []plugins.Item{}
+	}
+	return out.ok(items, strings.TrimRight(human.String(), "\n"))
+}
+
+func runPluginsChange(action string, args []string) int {
+	fs, out, kindFlag := pluginsFlagSet(action)
+	positional, ok := parse(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	kind := kindFlag()
+	if len(positional) != 1 {
+		return out.fail(exitUsage, fmt.Errorf("plugins %s takes exactly one %s id, see snail-installer plugins ls", action, kind))
+	}
+	id := positional[0]
+
+	var err error
+	switch action {
+	case "enable":
+		err = plugins.Enable(kind, id)
+	case "disable":
+		err = plugins.Disable(kind, id)
+	case "remove":
+		err = plugins.Remove(kind, id)
+	}
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	// enable -> enabled, remove -> removed
+	done := strings.TrimSuffix(action, "e") + "ed"
+	return out.ok(map[string]string{"id": id, "kind": string(kind), "action": action},
+		fmt.Sprintf("%s %s %s, restart slack to apply", done, kind, id))
+}
+
+func runPluginsInstall(args []string) int {
+	fs, out, kindFlag := pluginsFlagSet("install")
+	enable := fs.Bool("enable", false, "enable what was installed")
+	positional, ok := parse(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	kind := kindFlag()
+	if len(positional) != 1 {
+		return out.fail(exitUsage, errors.New("plugins install takes exactly one zip"))
+	}
+
+	ids, err := plugins.Install(kind, positional[0])
+	if err != nil {
+		return out.fail(exitError, err)
+	}
+	if *enable {
+		for _, id := range ids {
+			if err := plugins.Enable(kind, id); err != nil {
+				return out.fail(exitError, fmt.Errorf("installed %s but could not enable it: %w", id, err))
+			}
+		}
+	}
+
+	human := fmt.Sprintf("installed %s %s", kind, strings.Join(ids, ", "))
+	switch {
+	case *enable:
+		human += ", enabled, restart slack to apply"
+	case kind == plugins.Theme:
+		human += ", turn it on with snail-installer plugins enable --themes <id>"
+	default:
+		human += ", turn it on with snail-installer plugins enable <id>"
+	}
+	return out.ok(map[string]any{"installed": ids, "kind": kind, "enabled": *enable}, human)
+}
@@ -0,0 +1,381 @@
+package fuses
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Electron keeps its fuses right after this sentinel in the binary:
+// one version byte, one length byte, then one byte per fuse.
+// Universal macOS binaries have one wire per architecture.
+const Sentinel = "dL7pKGdnNz796PbbjQWNKmHXBZaB9tsX"
+
+const wireVersion = 1
+
+type Fuse int
+
+// order matters, it's the index in the wire
+const (
+	RunAsNode Fuse = iota
+	EnableCookieEncryption
+	EnableNodeOptionsEnvironmentVariable
+	EnableNodeCliInspectArguments
+	EnableEmbeddedAsarIntegrityValidation
+	OnlyLoadAppFromAsar
+	LoadBrowserProcessSpecificV8Snapshot
+	GrantFileProtocolExtraPrivileges
+	WasmTrapHandlers
+)
+
+var fuseNames = []string{
+	"RunAsNode",
+	"EnableCookieEncryption",
+	"EnableNodeOptionsEnvironmentVariable",
+	"EnableNodeCliInspectArguments",
+	"EnableEmbeddedAsarIntegrityValidation",
+	"OnlyLoadAppFromAsar",
+	"LoadBrowserProcessSpecificV8Snapshot",
+	"GrantFileProtocolExtraPrivileges",
+	"WasmTrapHandlers",
+}
+
+func (f Fuse) String() string {
+	if f >= 0 && int(f) < len(fuseNames) {
+		return fuseNames[f]
+	}
+	return fmt.Sprintf("Fuse%d", int(f))
+}
+
+func ParseFuse(name string) (Fuse, error) {
+	for i, n := range fuseNames {
+		if strings.EqualFold(n, name) {
+			return Fuse(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown fuse %q", name)
+}
+
+type State byte
+
+const (
+	Disabled State = '0'
+	Enabled  State = '1'
+	Removed  State = 'r'
+)
+
+func (s State) String() string {
+	switch s {
+	case Disabled:
+		return "disabled"
+	case Enabled:
+		return "enabled"
+	case Removed:
+		return "removed"
+	}
+	return fmt.Sprintf("unknown (0x%02x)", byte(s))
+}
+
+var ErrNoSentinel = errors.New("fuses: sentinel not found, not an electron binary?")
+
+type Wire struct {
+	Offset  int64 // of the first fuse byte
+	Version byte
+	States  []State
+}
+
+func (w Wire) State(f Fuse) (State, bool) {
+	if int(f) >= len(w.States) {
+		return 0, false
+	}
+	return w.States[f], true
+}
+
+type Binary struct {
+	Path   string
+	Format string // "mach-o", "pe", "elf" or "unknown"
+	Wires  []Wire
+}
+
+func Read(path string) (*Binary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format, err := detectFormat(f)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := findSentinels(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(offsets) == 0 {
+		return nil, ErrNoSentinel
+	}
+
+	bin := &Binary{Path: path, Format: format}
+	for _, off := range offsets {
+		wire, err := readWire(f, off+int64(len(Sentinel)))
+		if err != nil {
+			return nil, err
+		}
+		bin.Wires = append(bin.Wires, wire)
+	}
+
+	return bin, nil
+}
+
+func readWire(r io.ReaderAt, pos int64) (Wire, error) {
+	var head [2]byte
+	if _, err := r.ReadAt(head[:], pos); err != nil {
+		return Wire{}, fmt.Errorf("fuses: truncated wire at %d: %w", pos, err)
+	}
+	if head[0] != wireVersion {
+		return Wire{}, fmt.Errorf("fuses: unsupported wire version %d", head[0])
+	}
+
+	states := make([]byte, head[1])
+	if _, err := r.ReadAt(states, pos+2); err != nil {
+		return Wire{}, fmt.Errorf("fuses: truncated wire at %d: %w", pos, err)
+	}
+
+	wire := Wire{Offset: pos + 2, Version: head[0]}
+	for _, b := range states {
+		wire.States = append(wire.States, State(b))
+	}
+	return wire, nil
+}
+
+// scan in chunks so we never hold a 200MB framework in memory
+func findSentinels(r io.ReaderAt) ([]int64, error) {
+	const chunkSize = 1 << 20
+	sentinel := []byte(Sentinel)
+	overlap := len(sentinel) - 1
+
+	var offsets []int64
+	buf := make([]byte, chunkSize+overlap)
+	var base int64
+	carried := 0
+
+	for {
+		n, err := r.ReadAt(buf[carried:], base+int64(carried))
+		data := buf[:carried+n]
+
+		for i := 0; ; {
+			j := bytes.Index(data[i:], sentinel)
+			if j < 0 {
+				break
+			}
+			offsets = append(offsets, base+int64(i+j))
+			i += j + len(sentinel)
+		}
+
+		if err == io.EOF {
+			return offsets, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// keep the tail in case the sentinel straddles two chunks
+		keep := min(overlap, len(data))
+		copy(buf, data[len(data)-keep:])
+		base += int64(len(data) - keep)
+		carried = keep
+	}
+}
+
+func detectFormat(r io.ReaderAt) (string, error) {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return "", fmt.Errorf("fuses: file too small: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(magic[:], []byte{0x7f, 'E', 'L', 'F'}):
+		return "elf", nil
+	case magic[0] == 'M' && magic[1] == 'Z':
+		return "pe", nil
+	case isMachOMagic(magic):
+		return "mach-o", nil
+	}
+	return "unknown", nil
+}
+
+// IsMachO says whether path is a mach-o binary, thin or universal
+func IsMachO(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	format, err := detectFormat(f)
+	return err == nil && format == "mach-o"
+}
+
+func isMachOMagic(m [4]byte) bool {
+	for _, magic := range [][4]byte{
+		{0xfe, 0xed, 0xfa, 0xce}, {0xce, 0xfa, 0xed, 0xfe}, // 32 bit
+		{0xfe, 0xed, 0xfa, 0xcf}, {0xcf, 0xfa, 0xed, 0xfe}, // 64 bit
+		{0xca, 0xfe, 0xba, 0xbe}, {0xbe, 0xba, 0xfe, 0xca}, // universal
+	} {
+		if m == magic {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot holds the original wire bytes of a binary, enough to undo a Write
+type Snapshot struct {
+	Path  string           `json:"path"`
+	Taken time.Time        `json:"taken,omitempty"`
+	Wires map[int64][]byte `json:"wires"`
+}
+
+// Capture reads the fuses of a binary as they are now, Restore puts them back
+func Capture(path string) (*Snapshot, error) {
+	bin, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{Path: path, Taken: time.Now(), Wires: map[int64][]byte{}}
+	for _, wire := range bin.Wires {
+		original := make([]byte, len(wire.States))
+		for i, s := range wire.States {
+			original[i] = byte(s)
+		}
+		snapshot.Wires[wire.Offset] = original
+	}
+	return snapshot, nil
+}
+
+// Write sets fuses in every wire of the binary. The change goes to a temp file
+// next to the binary which is then renamed over it, and the bytes it replaced
+// are returned so they can be put back later.
+func Write(path string, changes map[Fuse]State) (*Snapshot, error) {
+	snapshot, err := Capture(path)
+	if err != nil {
+		return nil, err
+	}
+
+	patches := map[int64][]byte{}
+	for off, original := range snapshot.Wires {
+		updated := bytes.Clone(original)
+		for fuse, state := range changes {
+			if int(fuse) >= len(updated) {
+				return nil, fmt.Errorf("fuses: %s is not in this electron version", fuse)
+			}
+			if State(updated[fuse]) == Removed {
+				return nil, fmt.Errorf("fuses: %s was removed from this electron build", fuse)
+			}
+			updated[fuse] = byte(state)
+		}
+		patches[off] = updated
+	}
+
+	err = writeAtomic(path, patches)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Restore writes the snapshot's original bytes back
+func (s *Snapshot) Restore() error {
+	// make sure the file still looks like what we snapshotted
+	bin, err := Read(s.Path)
+	if err != nil {
+		return err
+	}
+	for off, data := range s.Wires {
+		found := false
+		for _, wire := range bin.Wires {
+			if wire.Offset == off && len(wire.States) == len(data) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("fuses: %s changed since the snapshot was taken", s.Path)
+		}
+	}
+
+	return writeAtomic(s.Path, s.Wires)
+}
+
+func (s *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func writeAtomic(path string, patches map[int64][]byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".fuses-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = io.Copy(tmp, src)
+	if err == nil {
+		for off, data := range patches {
+			if _, err = tmp.WriteAt(data, off); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("fuses: failed to write %s: %w", path, err)
+	}
+
+	err = os.Chmod(tmpPath, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	src.Close()
+	return os.Rename(tmpPath, path)
+}
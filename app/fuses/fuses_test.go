@@ -0,0 +1,207 @@
+package fuses
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// wire is a sentinel followed by a version 1 wire with states
+func wire(states string) []byte {
+	return append(append([]byte(Sentinel), wireVersion, byte(len(states))), states...)
+}
+
+func writeBinary(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "Electron Framework")
+	if err := os.WriteFile(path, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// a universal binary has a slice per architecture, each with its own wire
+func universalBinary() []byte {
+	data := []byte{0xca, 0xfe, 0xba, 0xbe}
+	data = append(data, make([]byte, 4092)...)
+	data = append(data, wire("101111011")...)
+	data = append(data, make([]byte, 4096)...)
+	data = append(data, wire("101111011")...)
+	return append(data, "end of arm64 slice"...)
+}
+
+func TestReadUniversal(t *testing.T) {
+	path := writeBinary(t, universalBinary())
+
+	bin, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bin.Format != "mach-o" {
+		t.Errorf("format is %s, want mach-o", bin.Format)
+	}
+	if len(bin.Wires) != 2 {
+		t.Fatalf("got %d wires, want 2", len(bin.Wires))
+	}
+	for i, w := range bin.Wires {
+		if s, _ := w.State(EnableCookieEncryption); s != Disabled {
+			t.Errorf("wire %d: EnableCookieEncryption is %s, want disabled", i, s)
+		}
+		if s, _ := w.State(EnableEmbeddedAsarIntegrityValidation); s != Enabled {
+			t.Errorf("wire %d: EnableEmbeddedAsarIntegrityValidation is %s, want enabled", i, s)
+		}
+	}
+}
+
+func TestWriteUniversal(t *testing.T) {
+	path := writeBinary(t, universalBinary())
+
+	if _, err := Write(path, map[Fuse]State{EnableEmbeddedAsarIntegrityValidation: Disabled}); err != nil {
+		t.Fatal(err)
+	}
+	bin, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range bin.Wires {
+		if s, _ := w.State(EnableEmbeddedAsarIntegrityValidation); s != Disabled {
+			t.Errorf("wire %d: fuse is %s after disabling it, both slices have to change", i, s)
+		}
+		if s, _ := w.State(OnlyLoadAppFromAsar); s != Enabled {
+			t.Errorf("wire %d: OnlyLoadAppFromAsar is %s, Write touched a fuse it wasn't given", i, s)
+		}
+	}
+}
+
+func TestFindSentinelsAcrossChunks(t *testing.T) {
+	const chunkSize = 1 << 20
+	tests := []struct {
+		name string
+		at   int
+	}{
+		{"start", 0},
+		{"ends at the boundary", chunkSize - len(Sentinel)},
+		{"straddles the boundary", chunkSize - len(Sentinel)/2},
+		{"one byte over", chunkSize - len(Sentinel) + 1},
+		{"starts at the boundary", chunkSize},
+		{"straddles the second boundary", 2*chunkSize - 10},
+		{"end of file", 3*chunkSize - len(Sentinel)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, 3*chunkSize)
+			copy(data[tt.at:], Sentinel)
+
+			offsets, err := findSentinels(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(offsets) != 1 || offsets[0] != int64(tt.at) {
+				t.Errorf("found %v, want [%d]", offsets, tt.at)
+			}
+		})
+	}
+}
+
+func TestReadTruncatedWire(t *testing.T) {
+	tests := []struct {
+		name string
+		tail []byte
+	}{
+		{"nothing after the sentinel", nil},
+		{"version only", []byte{wireVersion}},
+		{"fewer fuses than the length says", []byte{wireVersion, 9, '1', '1', '0'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte("\x7fELF"+Sentinel), tt.tail...)
+			if _, err := Read(writeBinary(t, data)); err == nil {
+				t.Error("read a truncated wire")
+			}
+		})
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	original := universalBinary()
+	path := writeBinary(t, original)
+
+	snapshot, err := Write(path, map[Fuse]State{
+		EnableEmbeddedAsarIntegrityValidation: Disabled,
+		RunAsNode:                             Enabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// it has to survive being saved to disk, that's how restore gets it
+	saved := filepath.Join(t.TempDir(), "fuses.json")
+	if err := snapshot.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSnapshot(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("binary is not the same as before Write after restoring")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("binary is %v after restoring, was 0755", info.Mode().Perm())
+	}
+}
+
+// a snapshot of an older build must not be written into a newer one
+func TestSnapshotRestoreChangedBinary(t *testing.T) {
+	path := writeBinary(t, universalBinary())
+	snapshot, err := Capture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved := append([]byte{0xca, 0xfe, 0xba, 0xbe, 0}, universalBinary()[4:]...)
+	if err := os.WriteFile(path, moved, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.Restore(); err == nil {
+		t.Error("restored a snapshot into a binary whose wires moved")
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.Equal(data, moved) {
+		t.Error("a failed restore changed the binary")
+	}
+}
+
+func TestIsMachO(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"universal", universalBinary(), true},
+		{"64 bit", []byte{0xcf, 0xfa, 0xed, 0xfe, 7, 0, 0, 1}, true},
+		{"elf", []byte("\x7fELF\x02\x01\x01"), false},
+		{"too short", []byte{0xcf, 0xfa}, false},
+	}
+	for _, tt := range tests {
+		if got := IsMachO(writeBinary(t, tt.data)); got != tt.want {
+			t.Errorf("%s: IsMachO = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if IsMachO(filepath.Join(t.TempDir(), "missing")) {
+		t.Error("a missing file is a mach-o binary")
+	}
+}
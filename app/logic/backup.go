@@ -0,0 +1,421 @@
+package logic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backups live in ~/.snail/backups as app-backup-<timestamp>.json, which
+// describes the backup and lists the chunks (see chunks.go) it's made of.
+// older installers copied the whole file to app-backup-<timestamp>.asar,
+// those still show up and restore, possibly with a .json next to them
+
+// keep this many backups when Settings.KeepBackups isn't set
+const defaultKeepBackups = 5
+
+type BackupMeta struct {
+	SlackVersion     string    `json:"slackVersion"`
+	SourcePath       string    `json:"sourcePath"` // the app.asar it was copied from
+	SHA256           string    `json:"sha256"`
+	Size             int64     `json:"size"`
+	Pristine         bool      `json:"pristine"` // no snail patch in it
+	InstallerVersion string    `json:"installerVersion"`
+	Created          time.Time `json:"created"`
+	// the last time a backup found this exact file again, retention goes by it
+	LastSeen time.Time `json:"lastSeen"`
+	// empty for full .asar copies
+	Chunks []string `json:"chunks,omitempty"`
+}
+
+type Backup struct {
+	Filepath string
+	Time     time.Time
+	// nil for backups made before there were sidecars
+	Meta *BackupMeta
+	// what's wrong with it, empty when it looks fine
+	Corrupt string
+}
+
+func backupDir() (string, error) {
+	dir, err := snailDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "backups"), nil
+}
+
+// metaPath is the .json of a backup, which for chunked backups is the backup
+func metaPath(backupPath string) string {
+	return strings.TrimSuffix(backupPath, filepath.Ext(backupPath)) + ".json"
+}
+
+func readBackupMeta(backupPath string) (*BackupMeta, error) {
+	data, err := os.ReadFile(metaPath(backupPath))
+	if err != nil {
+		return nil, err
+	}
+	var meta BackupMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func writeBackupMeta(backupPath string, meta *BackupMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := metaPath(backupPath) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, metaPath(backupPath))
+}
+
+// backupAppAsar stores app.asar in ~/.snail/backups, onBytes may be nil.
+// a file that is already backed up isn't stored again, and neither is one
+// with a snail patch in it: backups are for getting the original back
+func backupAppAsar(appAsarPath string, onBytes func(done, total int64)) error {
+
+	// check if app.asar exists
+	info, err := os.Stat(appAsarPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("app.asar not found at %s", appAsarPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	patchVersion, err := asarPatchVersion(appAsarPath)
+	if err != nil {
+		return fmt.Errorf("failed to read app.asar: %w", err)
+	}
+	if patchVersion >= 0 {
+		println(fmt.Sprintf("app.asar has snail patch v%d, not backing it up", patchVersion))
+		return nil
+	}
+
+	store, err := openChunkStore()
+	if err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	f, err := os.Open(appAsarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// hash and chunk in one read, the chunks slack versions share are only
+	// stored once
+	h := sha256.New()
+	counter := &progressWriter{w: h, total: info.Size(), onBytes: onBytes}
+	chunks, err := store.writeChunks(io.TeeReader(f, counter))
+	if err != nil {
+		return fmt.Errorf("failed to backup app.asar: %w", err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	now := time.Now()
+	for _, b := range GetBackupList() {
+		if b.Meta == nil || b.Corrupt != "" || b.Meta.SHA256 != sum {
+			continue
+		}
+		b.Meta.LastSeen = now
+		if err := writeBackupMeta(b.Filepath, b.Meta); err != nil {
+			return fmt.Errorf("failed to update backup metadata: %w", err)
+		}
+		println("app.asar is already backed up at:", b.Filepath)
+		return nil
+	}
+
+	dir := filepath.Dir(store.dir)
+	timestamp := now.Format("20060102-150405")
+	backupPath := filepath.Join(dir, fmt.Sprintf("app-backup-%s.json", timestamp))
+	for i := 1; fileExists(backupPath); i++ {
+		backupPath = filepath.Join(dir, fmt.Sprintf("app-backup-%s-%d.json", timestamp, i))
+	}
+
+	meta := &BackupMeta{
+		SlackVersion:     readSlackVersion(appAsarPath),
+		SourcePath:       appAsarPath,
+		SHA256:           sum,
+		Size:             counter.done,
+		Pristine:         true,
+		InstallerVersion: InstallerVersion,
+		Created:          now,
+		LastSeen:         now,
+		Chunks:           chunks,
+	}
+	if err := writeBackupMeta(backupPath, meta); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	println("Backup created at:", backupPath)
+
+	pruneBackups(backupPath)
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// openBackup streams the app.asar a backup holds
+func openBackup(path string) (io.ReadCloser, error) {
+	if filepath.Ext(path) != ".json" {
+		// a full copy, or any asar someone points us at
+		return os.Open(path)
+	}
+
+	meta, err := readBackupMeta(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	store, err := openChunkStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.reader(meta.Chunks), nil
+}
+
+// pruneBackups applies the retention settings: the KeepBackups most recently
+// seen backups stay, and the newest pristine one of every Slack version too,
+// however many there are: it's the only way back to that version. keep is
+// never removed, and the fuse snapshots go with the backups they belong to
+func pruneBackups(keep string) {
+	n := keepBackups()
+
+	backups := GetBackupList()
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+
+	used := map[string]bool{}
+	versionKept := map[string]bool{}
+	for i, b := range backups {
+		remove := true
+		if b.Meta != nil && b.Meta.Pristine && b.Corrupt == "" && !versionKept[b.Meta.SlackVersion] {
+			versionKept[b.Meta.SlackVersion] = true
+			remove = false
+		}
+		if i < n || b.Filepath == keep {
+			remove = false
+		}
+
+		if remove {
+			println("Removing old backup:", b.Filepath)
+			err := os.Remove(b.Filepath)
+			if err == nil {
+				err = os.Remove(metaPath(b.Filepath))
+			}
+			if err == nil || os.IsNotExist(err) {
+				continue
+			}
+			println("Warning: failed to remove backup:", err.Error())
+		}
+
+		if b.Meta != nil {
+			for _, sum := range b.Meta.Chunks {
+				used[sum] = true
+			}
+		}
+	}
+
+	if store, err := openChunkStore(); err == nil {
+		store.gc(used)
+	}
+	pruneFuseSnapshots(GetBackupList())
+}
+
+func keepBackups() int {
+	if AppSettings.KeepBackups <= 0 {
+		return defaultKeepBackups
+	}
+	return AppSettings.KeepBackups
+}
+
+// GetBackupList lists the app.asar backups with a quick check of each, it
+// doesn't read them. VerifyBackup does the full check
+func GetBackupList() []Backup {
+	dir, err := backupDir()
+	if err != nil {
+		return []Backup{}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return []Backup{}
+	}
+
+	var store *chunkStore
+
+	backups := []Backup{}
+	for _, file := range files {
+		name := file.Name()
+		// fuse snapshots and the chunks live in the same folder
+		if file.IsDir() || !strings.HasPrefix(name, "app-backup-") {
+			continue
+		}
+
+		b := Backup{Filepath: filepath.Join(dir, name)}
+		switch filepath.Ext(name) {
+		case ".asar":
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+			b.Time = info.ModTime()
+
+			meta, err := readBackupMeta(b.Filepath)
+			switch {
+			case err == nil:
+				b.Meta = meta
+				if info.Size() != meta.Size {
+					b.Corrupt = fmt.Sprintf("size is %d bytes, it was %d when backed up", info.Size(), meta.Size)
+				}
+			case !errors.Is(err, os.ErrNotExist):
+				b.Corrupt = "broken metadata: " + err.Error()
+			}
+		case ".json":
+			if fileExists(strings.TrimSuffix(b.Filepath, ".json") + ".asar") {
+				// sidecar of a full copy, listed with it
+				continue
+			}
+			meta, err := readBackupMeta(b.Filepath)
+			if err != nil {
+				b.Corrupt = "broken metadata: " + err.Error()
+				if info, err := file.Info(); err == nil {
+					b.Time = info.ModTime()
+				}
+				break
+			}
+			b.Meta = meta
+
+			if store == nil {
+				store = &chunkStore{dir: filepath.Join(dir, chunkDirName)}
+			}
+			if missing := store.missing(meta.Chunks); len(missing) > 0 {
+				b.Corrupt = fmt.Sprintf("%d of %d chunks are missing", len(missing), len(meta.Chunks))
+			}
+		default:
+			continue
+		}
+
+		if b.Meta != nil {
+			b.Time = b.Meta.LastSeen
+			if b.Time.IsZero() {
+				b.Time = b.Meta.Created
+			}
+		}
+		backups = append(backups, b)
+	}
+	return backups
+}
+
+// VerifyBackup reads the whole backup: its hash has to match the one taken
+// when it was made, and a full copy has to still look like Slack
+func VerifyBackup(path string) error {
+	meta, err := readBackupMeta(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("broken metadata: %w", err)
+	}
+
+	if meta != nil {
+		r, err := openBackup(path)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != meta.SHA256 {
+			return fmt.Errorf("sha256 is %s, it was %s when backed up", sum, meta.SHA256)
+		}
+	}
+
+	if filepath.Ext(path) == ".json" {
+		// only a real file can be opened as an archive, RestoreBackup checks
+		// it after putting it back together
+		return nil
+	}
+	return verifyBackup(path)
+}
+
+// BackupUsage is how much the backups would take as plain copies and how much
+// they take on disk
+func BackupUsage() (logical, onDisk int64, err error) {
+	for _, b := range GetBackupList() {
+		if b.Meta != nil {
+			logical += b.Meta.Size
+		} else if info, err := os.Stat(b.Filepath); err == nil {
+			logical += info.Size()
+		}
+	}
+
+	dir, err := backupDir()
+	if err != nil {
+		return 0, 0, err
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			onDisk += info.Size()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return logical, onDisk, err
+}
+
+// ExportBackup writes the app.asar a backup holds to dest, checked against
+// its hash when there's metadata
+func ExportBackup(path, dest string) error {
+	meta, err := readBackupMeta(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("broken metadata: %w", err)
+	}
+
+	r, err := openBackup(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && meta != nil {
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != meta.SHA256 {
+			err = fmt.Errorf("sha256 is %s, it was %s when backed up", sum, meta.SHA256)
+		}
+	}
+	if err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to export backup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package logic
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var stockSlack = map[string]string{
+	"package.json": `{"name":"slack","version":"4.41.0","main":"index.js"}`,
+	"index.js":     "require('./dist/main.js')\n",
+	"dist/main.js": "console.log('slack')\n",
+}
+
+func TestBackupSkipsPatchedAsar(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	asarPath := packApp(t, stockSlack)
+
+	if err := backupAppAsar(asarPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	patchAsarFile(t, asarPath)
+	if err := backupAppAsar(asarPath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	backups := GetBackupList()
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want only the pristine one", len(backups))
+	}
+	if !backups[0].Meta.Pristine {
+		t.Errorf("the backup isn't pristine")
+	}
+}
+
+func TestPruneKeepsNewestPristinePerVersion(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	AppSettings.KeepBackups = 1
+	defer func() { AppSettings.KeepBackups = 0 }()
+
+	// two pristine versions, then enough other backups to push them out
+	for i, version := range []string{"4.40.0", "4.41.0", "4.41.0", "4.41.0"} {
+		files := map[string]string{}
+		for k, v := range stockSlack {
+			files[k] = v
+		}
+		files["package.json"] = `{"name":"slack","version":"` + version + `","main":"index.js"}`
+		files["dist/main.js"] = strings.Repeat("x", i+1)
+		if err := backupAppAsar(packApp(t, files), nil); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	versions := map[string]int{}
+	for _, b := range GetBackupList() {
+		versions[b.Meta.SlackVersion]++
+	}
+	if versions["4.40.0"] != 1 || versions["4.41.0"] != 1 {
+		t.Errorf("kept %v, want the newest backup of 4.40.0 and 4.41.0", versions)
+	}
+}
+
+func TestPruneDoesNotCountPatchedAgainstPristine(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	AppSettings.KeepBackups = 1
+	defer func() { AppSettings.KeepBackups = 0 }()
+
+	if err := backupAppAsar(packApp(t, stockSlack), nil); err != nil {
+		t.Fatal(err)
+	}
+	// a patched backup from an older installer, newer than the pristine one
+	dir, _ := backupDir()
+	meta := &BackupMeta{SlackVersion: "4.41.0", Pristine: false, Created: time.Now().Add(time.Hour), LastSeen: time.Now().Add(time.Hour)}
+	if err := writeBackupMeta(filepath.Join(dir, "app-backup-29990101-000000.json"), meta); err != nil {
+		t.Fatal(err)
+	}
+	pruneBackups("")
+
+	pristine := 0
+	for _, b := range GetBackupList() {
+		if b.Meta != nil && b.Meta.Pristine {
+			pristine++
+		}
+	}
+	if pristine != 1 {
+		t.Errorf("the patched backup pushed out the only pristine one")
+	}
+}
@@ -0,0 +1,110 @@
+package logic
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// a snail bundle is a zip made by the webserver's bundle command: its signed
+// manifest.json and manifest.json.sig, the files the manifest lists and the
+// default config.json. it installs snail without reaching the asset server
+
+type Bundle struct {
+	Path     string
+	Manifest *Manifest
+	zr       *zip.ReadCloser
+}
+
+// OpenBundle opens a bundle and checks its manifest signature
+func OpenBundle(path string) (*Bundle, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	b := &Bundle{Path: path, zr: zr}
+
+	data, err := b.readSmall("manifest.json")
+	if err == nil {
+		var sig []byte
+		sig, err = b.readSmall("manifest.json.sig")
+		var pub ed25519.PublicKey
+		if err == nil {
+			pub, err = manifestKey()
+		}
+		if err == nil {
+			b.Manifest, err = parseManifest(data, sig, pub)
+		}
+	}
+	if err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("%s is not a usable snail bundle: %w", path, err)
+	}
+
+	return b, nil
+}
+
+func (b *Bundle) Close() error {
+	return b.zr.Close()
+}
+
+func (b *Bundle) readSmall(name string) ([]byte, error) {
+	f, err := b.zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("%s is too big", name)
+	}
+	return data, nil
+}
+
+// Extract writes name to destPath, only if it matches the signed manifest
+func (b *Bundle) Extract(name, destPath string) error {
+	if b.Manifest.Find(name) == nil {
+		return fmt.Errorf("%s is not in the signed manifest", name)
+	}
+
+	src, err := b.zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("bundle has no %s: %w", name, err)
+	}
+	defer src.Close()
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, src)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = b.Manifest.VerifyFile(name, destPath)
+	}
+	if err != nil {
+		os.Remove(destPath)
+		return err
+	}
+	return nil
+}
+
+// Config is the default config.json, nil if the bundle has none
+func (b *Bundle) Config() ([]byte, error) {
+	data, err := b.readSmall("config.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
@@ -0,0 +1,316 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// downloads are kept in ~/.snail/cache/blobs/<sha256>, index.json maps each
+// url to the blob it last gave us and its etag for revalidation
+
+// the cache never grows past this, least recently used blobs go first
+const maxCacheSize = 64 << 20
+
+type assetCache struct {
+	dir   string
+	index cacheIndex
+}
+
+type cacheIndex struct {
+	Entries map[string]*cacheEntry `json:"entries"`
+}
+
+type cacheEntry struct {
+	SHA256   string    `json:"sha256"`
+	ETag     string    `json:"etag,omitempty"`
+	Size     int64     `json:"size"`
+	Fetched  time.Time `json:"fetched"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+func cacheDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".snail", "cache"), nil
+}
+
+func openCache() (*assetCache, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0755); err != nil {
+		return nil, err
+	}
+
+	c := &assetCache{dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err == nil {
+		if err := json.Unmarshal(data, &c.index); err != nil {
+			// the blobs are still fine, they just get downloaded again
+			println("Warning: ignoring broken cache index:", err.Error())
+			c.index = cacheIndex{}
+		}
+	}
+	if c.index.Entries == nil {
+		c.index.Entries = map[string]*cacheEntry{}
+	}
+	return c, nil
+}
+
+func (c *assetCache) blobPath(sum string) string {
+	return filepath.Join(c.dir, "blobs", sum)
+}
+
+func (c *assetCache) save() error {
+	data, err := json.MarshalIndent(c.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(c.dir, "index.json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(c.dir, "index.json"))
+}
+
+// offline is true for errors where the server never answered
+func offline(err error) bool {
+	var statusErr *httpStatusError
+	return !errors.As(err, &statusErr) && !errors.Is(err, context.Canceled)
+}
+
+// fetch returns the path of the cached blob for url. a cached copy is
+// revalidated with If-None-Match, and used as is when the server can't be reached
+func (c *assetCache) fetch(ctx context.Context, d *downloader, url string, onBytes func(done, total int64)) (string, error) {
+	entry := c.index.Entries[url]
+	if entry != nil {
+		if _, err := os.Stat(c.blobPath(entry.SHA256)); err != nil {
+			entry = nil
+		}
+	}
+
+	etag := ""
+	if entry != nil {
+		etag = entry.ETag
+
+		// with a copy to fall back on, don't sit through every retry when offline
+		quick := *d
+		quick.attempts = min(quick.attempts, 2)
+		d = &quick
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "download-*")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	newETag, notModified, err := d.fetch(ctx, url, tmpPath, etag, onBytes)
+	switch {
+	case err == nil && notModified:
+		println("Using cached", url, "(not modified)")
+		if onBytes != nil {
+			onBytes(entry.Size, entry.Size)
+		}
+	case err == nil:
+		entry, err = c.store(tmpPath, newETag)
+		if err != nil {
+			return "", err
+		}
+		c.index.Entries[url] = entry
+	case entry != nil && offline(err):
+		println("Using cached", url, "because the server can't be reached:", err.Error())
+	default:
+		return "", err
+	}
+
+	entry.LastUsed = time.Now()
+	c.evict(entry.SHA256)
+	if err := c.save(); err != nil {
+		println("Warning: failed to save cache index:", err.Error())
+	}
+	return c.blobPath(entry.SHA256), nil
+}
+
+// store moves a finished download into blobs/ under its hash
+func (c *assetCache) store(path, etag string) (*cacheEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	if err := os.Rename(path, c.blobPath(sum)); err != nil {
+		return nil, err
+	}
+
+	return &cacheEntry{
+		SHA256:  sum,
+		ETag:    etag,
+		Size:    size,
+		Fetched: time.Now(),
+	}, nil
+}
+
+// evict drops blobs no url points at, then the least recently used ones
+// until the cache fits in maxCacheSize. keep is never dropped
+func (c *assetCache) evict(keep string) {
+	lastUsed := map[string]time.Time{}
+	for url, entry := range c.index.Entries {
+		if _, err := os.Stat(c.blobPath(entry.SHA256)); err != nil {
+			delete(c.index.Entries, url)
+			continue
+		}
+		if entry.LastUsed.After(lastUsed[entry.SHA256]) {
+			lastUsed[entry.SHA256] = entry.LastUsed
+		}
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(c.dir, "blobs"))
+	if err != nil {
+		return
+	}
+
+	type blob struct {
+		sum      string
+		size     int64
+		lastUsed time.Time
+	}
+	var kept []blob
+	var total int64
+	for _, b := range blobs {
+		info, err := b.Info()
+		if err != nil {
+			continue
+		}
+		used, ok := lastUsed[b.Name()]
+		if !ok && b.Name() != keep {
+			os.Remove(c.blobPath(b.Name()))
+			continue
+		}
+		kept = append(kept, blob{b.Name(), info.Size(), used})
+		total += info.Size()
+	}
+
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].lastUsed.Before(kept[j].lastUsed)
+	})
+	for _, b := range kept {
+		if total <= maxCacheSize {
+			break
+		}
+		if b.sum == keep {
+			continue
+		}
+		os.Remove(c.blobPath(b.sum))
+		total -= b.size
+		for url, entry := range c.index.Entries {
+			if entry.SHA256 == b.sum {
+				delete(c.index.Entries, url)
+			}
+		}
+	}
+}
+
+// cachedDownload is downloader.Download through the cache
+func cachedDownload(ctx context.Context, url, destPath string, onBytes func(done, total int64)) error {
+	d, err := newDownloader()
+	if err != nil {
+		return err
+	}
+	c, err := openCache()
+	if err != nil {
+		return err
+	}
+
+	blob, err := c.fetch(ctx, d, url, onBytes)
+	if err != nil {
+		return err
+	}
+	return copyFile(blob, destPath)
+}
+
+// cachedGet is downloader.Get through the cache
+func cachedGet(ctx context.Context, url string, maxSize int64) ([]byte, error) {
+	d, err := newDownloader()
+	if err != nil {
+		return nil, err
+	}
+	c, err := openCache()
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := c.fetch(ctx, d, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(blob)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%s is too big", url)
+	}
+	return data, nil
+}
+
+// CacheSize is how much ~/.snail/cache takes up
+func CacheSize() (int64, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return total, err
+}
+
+// ClearCache deletes every cached download, the next install fetches
+// everything again
+func ClearCache() error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
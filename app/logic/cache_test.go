@@ -0,0 +1,120 @@
+package logic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// etagServer serves body with an etag and answers If-None-Match with a 304
+func etagServer(t *testing.T, body string) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	var requests, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests, &notModified
+}
+
+func fetchCached(t *testing.T, d *downloader, url string) string {
+	t.Helper()
+	c, err := openCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := c.fetch(context.Background(), d, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCacheNotModified(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv, requests, notModified := etagServer(t, "inject")
+	d := testDownloader(srv)
+
+	if got := fetchCached(t, d, srv.URL); got != "inject" {
+		t.Fatalf("first fetch got %q", got)
+	}
+	if got := fetchCached(t, d, srv.URL); got != "inject" {
+		t.Fatalf("cache hit got %q", got)
+	}
+	if requests.Load() != 2 || notModified.Load() != 1 {
+		t.Errorf("%d requests, %d answered 304, want the second one revalidated", requests.Load(), notModified.Load())
+	}
+}
+
+func TestCacheOffline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv, _, _ := etagServer(t, "inject")
+	d := testDownloader(srv)
+
+	fetchCached(t, d, srv.URL)
+	srv.Close()
+
+	// every retry fails, the cached copy is used
+	if got := fetchCached(t, d, srv.URL); got != "inject" {
+		t.Errorf("offline fetch got %q", got)
+	}
+}
+
+// running out of retries with nothing cached is an error, a server that
+// answers with one isn't offline and doesn't get the cached copy either
+func TestCacheRetriesRunOut(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var failing atomic.Bool
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("inject"))
+	}))
+	defer srv.Close()
+	d := testDownloader(srv)
+
+	c, err := openCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing.Store(true)
+	if _, err := c.fetch(context.Background(), d, srv.URL, nil); err == nil {
+		t.Fatal("fetch with nothing cached and a failing server succeeded")
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("made %d requests, want all 3 attempts", n)
+	}
+
+	failing.Store(false)
+	fetchCached(t, d, srv.URL)
+	failing.Store(true)
+	requests.Store(0)
+	c, err = openCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.fetch(context.Background(), d, srv.URL, nil); err == nil {
+		t.Error("a 503 was served from the cache as if offline")
+	}
+	// with a copy to fall back on it doesn't sit through every retry
+	if n := requests.Load(); n != 2 {
+		t.Errorf("made %d requests with a cached copy, want 2", n)
+	}
+}
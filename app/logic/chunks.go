@@ -0,0 +1,244 @@
+package logic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// backups are stored as gzipped, content addressed chunks in
+// ~/.snail/backups/chunks/<sha256>. chunk boundaries come from the content
+// (a gear rolling hash, like FastCDC) instead of fixed offsets, so a header
+// that grew by a few bytes doesn't shift every chunk after it and two
+// backups of the same Slack version share nearly all of their chunks
+
+const (
+	minChunkSize  = 64 << 10
+	maxChunkSize  = 1 << 20
+	chunkCutMask  = 1<<18 - 1 // ~256KB average on top of minChunkSize
+	chunkDirName  = "chunks"
+	chunkCompress = gzip.BestSpeed // asars are hundreds of MB, speed matters more
+)
+
+// random but fixed forever, changing it would stop old and new backups
+// from sharing chunks
+var gearTable = func() (t [256]uint64) {
+	for i := range t {
+		sum := sha256.Sum256([]byte{'s', 'n', 'a', 'i', 'l', byte(i)})
+		t[i] = binary.LittleEndian.Uint64(sum[:])
+	}
+	return t
+}()
+
+// chunker splits a stream into content defined chunks
+type chunker struct {
+	r   io.Reader
+	buf []byte
+	n   int
+	eof bool
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: r, buf: make([]byte, maxChunkSize)}
+}
+
+// next returns the next chunk, io.EOF after the last one
+func (c *chunker) next() ([]byte, error) {
+	for !c.eof && c.n < len(c.buf) {
+		m, err := c.r.Read(c.buf[c.n:])
+		c.n += m
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.n == 0 {
+		return nil, io.EOF
+	}
+
+	cut := chunkCutPoint(c.buf[:c.n])
+	chunk := make([]byte, cut)
+	copy(chunk, c.buf[:cut])
+	c.n = copy(c.buf, c.buf[cut:c.n])
+	return chunk, nil
+}
+
+func chunkCutPoint(b []byte) int {
+	if len(b) <= minChunkSize {
+		return len(b)
+	}
+	var h uint64
+	for i := minChunkSize; i < len(b); i++ {
+		h = h<<1 + gearTable[b[i]]
+		if h&chunkCutMask == 0 {
+			return i + 1
+		}
+	}
+	return len(b)
+}
+
+type chunkStore struct {
+	dir string
+}
+
+func openChunkStore() (*chunkStore, error) {
+	dir, err := backupDir()
+	if err != nil {
+		return nil, err
+	}
+	s := &chunkStore{dir: filepath.Join(dir, chunkDirName)}
+	return s, os.MkdirAll(s.dir, 0755)
+}
+
+func (s *chunkStore) path(sum string) string {
+	return filepath.Join(s.dir, sum)
+}
+
+// put stores a chunk unless it's already there and returns its hash
+func (s *chunkStore) put(data []byte) (string, error) {
+	h := sha256.Sum256(data)
+	sum := hex.EncodeToString(h[:])
+	if fileExists(s.path(sum)) {
+		return sum, nil
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "chunk-*")
+	if err != nil {
+		return "", err
+	}
+	zw, _ := gzip.NewWriterLevel(tmp, chunkCompress)
+	_, err = zw.Write(data)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(sum))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return sum, nil
+}
+
+// writeChunks splits r into the store and returns the chunk list
+func (s *chunkStore) writeChunks(r io.Reader) ([]string, error) {
+	var sums []string
+	c := newChunker(r)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			return sums, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sum, err := s.put(chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store chunk: %w", err)
+		}
+		sums = append(sums, sum)
+	}
+}
+
+func (s *chunkStore) missing(sums []string) []string {
+	var missing []string
+	for _, sum := range sums {
+		if !fileExists(s.path(sum)) {
+			missing = append(missing, sum)
+		}
+	}
+	return missing
+}
+
+// gc removes chunks no backup uses anymore
+func (s *chunkStore) gc(used map[string]bool) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !used[e.Name()] {
+			os.Remove(s.path(e.Name()))
+		}
+	}
+}
+
+// chunkReader streams the chunks back one after the other, each one checked
+// against its hash on the way
+type chunkReader struct {
+	store *chunkStore
+	sums  []string
+	cur   io.ReadCloser
+	zr    *gzip.Reader
+	want  []byte
+	h     hash.Hash
+}
+
+func (s *chunkStore) reader(sums []string) *chunkReader {
+	return &chunkReader{store: s, sums: sums}
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.zr == nil {
+			if len(r.sums) == 0 {
+				return 0, io.EOF
+			}
+			sum := r.sums[0]
+			r.sums = r.sums[1:]
+
+			f, err := os.Open(r.store.path(sum))
+			if err != nil {
+				return 0, fmt.Errorf("chunk %s: %w", sum, err)
+			}
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				f.Close()
+				return 0, fmt.Errorf("chunk %s: %w", sum, err)
+			}
+			r.cur, r.zr = f, zr
+			r.want, _ = hex.DecodeString(sum)
+			r.h = sha256.New()
+		}
+
+		n, err := r.zr.Read(p)
+		r.h.Write(p[:n])
+		if err == io.EOF {
+			r.closeChunk()
+			if got := r.h.Sum(nil); !bytes.Equal(got, r.want) {
+				return n, errors.New("chunk does not match its hash, the backup is corrupt")
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) closeChunk() {
+	if r.zr != nil {
+		r.zr.Close()
+		r.cur.Close()
+		r.zr, r.cur = nil, nil
+	}
+}
+
+func (r *chunkReader) Close() error {
+	r.closeChunk()
+	return nil
+}
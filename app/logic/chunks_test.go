@@ -0,0 +1,102 @@
+package logic
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// syntheticSlack is a slack-like app of about size bytes: mostly minified
+// js that compresses well, and random bytes (images, wasm) for the share
+// that doesn't
+func syntheticSlack(size, random int) map[string]string {
+	rng := rand.New(rand.NewSource(1))
+	files := map[string]string{}
+	for k, v := range stockSlack {
+		files[k] = v
+	}
+
+	const fileSize = 512 << 10
+	words := []string{"function", "return", "const", "this", "slack", "window", "=>", "{", "}", "(", ")", ";", "null", "async"}
+	for i := 0; i*fileSize < size-random; i++ {
+		var b strings.Builder
+		for b.Len() < fileSize {
+			b.WriteString(words[rng.Intn(len(words))])
+			fmt.Fprintf(&b, "%x ", rng.Intn(1<<16))
+		}
+		files[fmt.Sprintf("dist/chunk-%03d.js", i)] = b.String()
+	}
+	for i := 0; i*fileSize < random; i++ {
+		data := make([]byte, fileSize)
+		rng.Read(data)
+		files[fmt.Sprintf("dist/assets/blob-%03d.bin", i)] = string(data)
+	}
+	return files
+}
+
+// backupSizes backs up a synthetic slack, then the same slack patched, and
+// returns what each backup added on disk
+func backupSizes(t testing.TB, size, random int) (first, patched, logical int64) {
+	t.Setenv("HOME", t.TempDir())
+	asarPath := packApp(t, syntheticSlack(size, random))
+
+	if err := backupAppAsar(asarPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	logical, first, err := BackupUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// patching moves every file's offset, only the chunks around the header
+	// and the entrypoint should be new. backups skip patched files, so make
+	// it look like another pristine build of the same version
+	patchAsarFile(t, asarPath)
+	editAsar(t, asarPath, func(app *asarEdits) error {
+		_, err := unpatchApp(app)
+		if err == nil {
+			err = app.WriteFile("dist/extra.js", []byte("console.log('one more file')\n"))
+		}
+		return err
+	})
+	if err := backupAppAsar(asarPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, both, err := BackupUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return first, both - first, logical
+}
+
+func TestBackupChunksSaveSpace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("packs a 24MB app")
+	}
+	first, added, logical := backupSizes(t, 24<<20, 4<<20)
+	t.Logf("%d byte asar: first backup %d bytes on disk, a changed build added %d", logical, first, added)
+
+	if first >= logical {
+		t.Errorf("first backup takes %d bytes, the asar is %d", first, logical)
+	}
+	// a small change next to the header costs a few chunks, not a copy
+	if added > logical/10 {
+		t.Errorf("a build with one more file added %d bytes, more than a tenth of %d", added, logical)
+	}
+}
+
+// BenchmarkBackupChunks reports what backups take on disk for an app the
+// size of slack's: go test -run xxx -bench BackupChunks -benchtime 1x
+func BenchmarkBackupChunks(b *testing.B) {
+	if testing.Short() {
+		b.Skip("packs a 147MB app")
+	}
+	var first, added, logical int64
+	for i := 0; i < b.N; i++ {
+		first, added, logical = backupSizes(b, 147<<20, 30<<20)
+	}
+	b.ReportMetric(float64(logical)/(1<<20), "asar-MB")
+	b.ReportMetric(float64(first)/(1<<20), "first-backup-MB")
+	b.ReportMetric(float64(added)/(1<<20), "changed-build-MB")
+}
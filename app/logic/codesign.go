@@ -0,0 +1,84 @@
+package logic
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"snail-installer/fuses"
+)
+
+// codesign --deep rewrites the signature embedded in every mach-o file of
+// the app and the _CodeSignature folders next to them. a copy of those is
+// all it takes to put slack's own signature back, no ad-hoc one.
+//
+// that copy is the price of getting the signature back: every mach-o file
+// is copied whole, Electron Framework alone is a few hundred MB, on every
+// install and restore on macOS. only the signature inside each binary
+// changes, but codesign may resize it and move the slices of a universal
+// binary with it, so putting back just those bytes would mean redoing
+// codesign's layout. the copy goes to the temp dir and is gone afterwards
+
+type signatureSnapshot struct {
+	appPath string
+	dir     string
+	files   []string // relative to appPath
+}
+
+// snapshotSignature copies everything codesign may change in appPath to dir
+func snapshotSignature(appPath, dir string) (*signatureSnapshot, error) {
+	s := &signatureSnapshot{appPath: appPath, dir: dir}
+	err := filepath.WalkDir(appPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// symlinks (Versions/Current and friends) point at files we copy anyway
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		signed := filepath.Base(filepath.Dir(p)) == "_CodeSignature" || d.Name() == "CodeResources" || fuses.IsMachO(p)
+		if !signed {
+			return nil
+		}
+
+		rel, err := filepath.Rel(appPath, p)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(p, dest); err != nil {
+			return err
+		}
+		s.files = append(s.files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to keep a copy of the code signature: %w", err)
+	}
+	return s, nil
+}
+
+// restore puts the signed files back, and removes _CodeSignature files
+// codesign added
+func (s *signatureSnapshot) restore() error {
+	kept := map[string]bool{}
+	for _, rel := range s.files {
+		kept[rel] = true
+		if err := replaceFile(filepath.Join(s.dir, rel), filepath.Join(s.appPath, rel), nil); err != nil {
+			return err
+		}
+	}
+	return filepath.WalkDir(s.appPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || filepath.Base(filepath.Dir(p)) != "_CodeSignature" {
+			return err
+		}
+		rel, err := filepath.Rel(s.appPath, p)
+		if err == nil && !kept[rel] {
+			err = os.Remove(p)
+		}
+		return err
+	})
+}
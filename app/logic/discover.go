@@ -0,0 +1,196 @@
+package logic
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"snail-installer/utils"
+	"sort"
+)
+
+type SlackInstall struct {
+	Path     string `json:"path"` // what the rest of logic takes as TargetPath
+	AsarPath string `json:"asarPath"`
+	Version  string `json:"version"`
+	Type     string `json:"type"`
+}
+
+// where to look, split out so it can point at a fake tree
+type discoverEnv struct {
+	goos         string
+	home         string
+	localAppData string
+	programFiles string
+	root         string // prefix for absolute system paths
+}
+
+// DiscoverSlackInstalls returns every Slack install it can find on this machine
+func DiscoverSlackInstalls() []SlackInstall {
+	home, _ := os.UserHomeDir()
+	return discoverSlackInstalls(discoverEnv{
+		goos:         runtime.GOOS,
+		home:         home,
+		localAppData: os.Getenv("LOCALAPPDATA"),
+		programFiles: os.Getenv("ProgramFiles"),
+		root:         "/",
+	})
+}
+
+type slackCandidate struct {
+	path        string
+	installType string
+}
+
+func discoverSlackInstalls(env discoverEnv) []SlackInstall {
+	var candidates []slackCandidate
+	add := func(installType string, paths ...string) {
+		for _, p := range paths {
+			candidates = append(candidates, slackCandidate{p, installType})
+		}
+	}
+	glob := func(pattern string) []string {
+		matches, _ := filepath.Glob(pattern)
+		return matches
+	}
+	sys := func(p string) string {
+		return filepath.Join(env.root, filepath.FromSlash(p))
+	}
+
+	switch env.goos {
+	case "darwin":
+		add("system", sys("/Applications/Slack.app"))
+		if env.home != "" {
+			add("user", filepath.Join(env.home, "Applications", "Slack.app"))
+		}
+
+	case "windows":
+		// squirrel keeps one app-x.y.z folder per version, usually just the current one
+		if env.localAppData != "" {
+			add("squirrel", glob(filepath.Join(env.localAppData, "slack", "app-*", "slack.exe"))...)
+		}
+		// msi / machine wide installs
+		if env.programFiles != "" {
+			add("machine", filepath.Join(env.programFiles, "Slack", "slack.exe"))
+		}
+
+	case "linux":
+		add("system", sys("/usr/lib/slack"))
+		add("snap", sys("/snap/slack/current/usr/lib/slack"))
+		// flatpak: <installation>/app/com.slack.Slack/<arch>/<branch>/active/files/extra/lib/slack
+		add("flatpak", glob(sys("/var/lib/flatpak/app/com.slack.Slack/*/*/active/files/extra/lib/slack"))...)
+		if env.home != "" {
+			add("flatpak-user", glob(filepath.Join(env.home, ".local", "share", "flatpak", "app", "com.slack.Slack", "*", "*", "active", "files", "extra", "lib", "slack"))...)
+		}
+	}
+
+	var installs []SlackInstall
+	seen := map[string]bool{}
+
+	for _, c := range candidates {
+		asarPath, err := appAsarPathFor(env.goos, c.path)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(asarPath); err != nil {
+			continue
+		}
+
+		// /snap/slack/current is a symlink, don't list things twice
+		real, err := filepath.EvalSymlinks(asarPath)
+		if err != nil {
+			real = asarPath
+		}
+		if seen[real] {
+			continue
+		}
+		seen[real] = true
+
+		installs = append(installs, SlackInstall{
+			Path:     c.path,
+			AsarPath: asarPath,
+			Version:  readSlackVersion(asarPath),
+			Type:     c.installType,
+		})
+	}
+
+	// keep the order of the locations above, newest version first within one
+	// (glob sorts app-4.9.0 after app-4.41.97)
+	order := map[string]int{}
+	for i, c := range candidates {
+		if _, ok := order[c.installType]; !ok {
+			order[c.installType] = i
+		}
+	}
+	sort.SliceStable(installs, func(i, j int) bool {
+		if installs[i].Type != installs[j].Type {
+			return order[installs[i].Type] < order[installs[j].Type]
+		}
+		return compareVersions(installs[i].Version, installs[j].Version) > 0
+	})
+
+	return installs
+}
+
+// readSlackVersion returns the version from package.json inside the asar,
+// or "" if it can't be read
+func readSlackVersion(asarPath string) string {
+	archive, err := utils.OpenAsar(asarPath)
+	if err != nil {
+		return ""
+	}
+	defer archive.Close()
+
+	data, err := archive.ReadFile("package.json")
+	if err != nil {
+		return ""
+	}
+
+	var pkg struct {
+		Version string `json:"version"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return ""
+	}
+	return pkg.Version
+}
+
+// compareVersions compares dotted numeric versions like 4.41.97,
+// anything that isn't a number sorts as 0
+func compareVersions(a, b string) int {
+	pa, pb := splitVersion(a), splitVersion(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x > y {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func splitVersion(v string) []int {
+	var parts []int
+	n := 0
+	for _, r := range v + "." {
+		switch {
+		case r >= '0' && r <= '9':
+			n = n*10 + int(r-'0')
+		case r == '.':
+			parts = append(parts, n)
+			n = 0
+		default:
+			// stop at pre-release suffixes like -beta
+			return append(parts, n)
+		}
+	}
+	return parts
+}
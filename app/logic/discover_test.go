@@ -0,0 +1,96 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"snail-installer/utils"
+	"testing"
+)
+
+// slackAt packs an app.asar of version where goos keeps it for path
+func slackAt(t *testing.T, goos, path, version string) {
+	t.Helper()
+	asarPath, err := appAsarPathFor(goos, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := t.TempDir()
+	pkg := `{"name":"slack","version":"` + version + `","main":"index.js"}`
+	if err := os.WriteFile(filepath.Join(app, "package.json"), []byte(pkg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(asarPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.PackFolderToAsar(app, asarPath, utils.PackOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if goos == "windows" {
+		// windows installs are found by their exe
+		if err := os.WriteFile(path, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiscoverSlackInstalls(t *testing.T) {
+	type found struct{ path, version, kind string }
+
+	tests := []struct {
+		goos  string
+		setup func(env discoverEnv) []found
+	}{
+		{"linux", func(env discoverEnv) []found {
+			system := filepath.Join(env.root, "usr", "lib", "slack")
+			flatpak := filepath.Join(env.home, ".local", "share", "flatpak", "app", "com.slack.Slack", "x86_64", "stable", "active", "files", "extra", "lib", "slack")
+			slackAt(t, "linux", system, "4.41.97")
+			slackAt(t, "linux", flatpak, "4.40.0")
+			// snap's current is a symlink to a revision, that one has no app.asar
+			os.MkdirAll(filepath.Join(env.root, "snap", "slack", "123", "usr", "lib", "slack"), 0755)
+			os.Symlink("123", filepath.Join(env.root, "snap", "slack", "current"))
+			return []found{{system, "4.41.97", "system"}, {flatpak, "4.40.0", "flatpak-user"}}
+		}},
+		{"darwin", func(env discoverEnv) []found {
+			system := filepath.Join(env.root, "Applications", "Slack.app")
+			user := filepath.Join(env.home, "Applications", "Slack.app")
+			slackAt(t, "darwin", system, "4.41.97")
+			slackAt(t, "darwin", user, "4.39.0")
+			return []found{{system, "4.41.97", "system"}, {user, "4.39.0", "user"}}
+		}},
+		{"windows", func(env discoverEnv) []found {
+			// glob sorts app-4.9.0 after app-4.41.97, newest has to come first
+			older := filepath.Join(env.localAppData, "slack", "app-4.9.0", "slack.exe")
+			newer := filepath.Join(env.localAppData, "slack", "app-4.41.97", "slack.exe")
+			machine := filepath.Join(env.programFiles, "Slack", "slack.exe")
+			slackAt(t, "windows", older, "4.9.0")
+			slackAt(t, "windows", newer, "4.41.97")
+			slackAt(t, "windows", machine, "4.41.97")
+			return []found{{newer, "4.41.97", "squirrel"}, {older, "4.9.0", "squirrel"}, {machine, "4.41.97", "machine"}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.goos, func(t *testing.T) {
+			tmp := t.TempDir()
+			env := discoverEnv{
+				goos:         tt.goos,
+				home:         filepath.Join(tmp, "home"),
+				localAppData: filepath.Join(tmp, "localappdata"),
+				programFiles: filepath.Join(tmp, "programfiles"),
+				root:         filepath.Join(tmp, "root"),
+			}
+			want := tt.setup(env)
+
+			got := discoverSlackInstalls(env)
+			if len(got) != len(want) {
+				t.Fatalf("found %+v, want %+v", got, want)
+			}
+			for i, w := range want {
+				g := got[i]
+				if g.Path != w.path || g.Version != w.version || g.Type != w.kind {
+					t.Errorf("install %d is %s %s (%s), want %s %s (%s)", i, g.Path, g.Version, g.Type, w.path, w.version, w.kind)
+				}
+			}
+		})
+	}
+}
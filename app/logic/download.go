@@ -0,0 +1,332 @@
+package logic
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultUserAgent = "snail-installer"
+
+// downloader is the one http client everything in logic downloads with
+type downloader struct {
+	client    *http.Client
+	userAgent string
+
+	attempts     int
+	backoff      time.Duration // doubles after every failed attempt
+	maxBackoff   time.Duration
+	stallTimeout time.Duration // give up on an attempt when no bytes arrive for this long
+}
+
+// newDownloader builds a downloader from AppSettings: proxies come from
+// HTTPS_PROXY / HTTP_PROXY / NO_PROXY, extra CAs from Settings.CABundles
+func newDownloader() (*downloader, error) {
+	tlsConfig := &tls.Config{}
+	if len(AppSettings.CABundles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range AppSettings.CABundles {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   15 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+
+	userAgent := AppSettings.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+
+	return &downloader{
+		client:       &http.Client{Transport: transport},
+		userAgent:    userAgent,
+		attempts:     5,
+		backoff:      500 * time.Millisecond,
+		maxBackoff:   10 * time.Second,
+		stallTimeout: 30 * time.Second,
+	}, nil
+}
+
+// httpStatusError is a response we didn't want, only some are worth retrying
+type httpStatusError struct {
+	status string
+	code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return e.status
+}
+
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errNotModified) {
+		return false
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == http.StatusTooManyRequests || statusErr.code == http.StatusRequestTimeout
+	}
+	// network errors, timeouts, connections dropped halfway
+	return true
+}
+
+// retry runs fn until it works, fails for good or runs out of attempts
+func (d *downloader) retry(ctx context.Context, url string, fn func() error) error {
+	wait := d.backoff
+	var err error
+	for attempt := 1; attempt <= d.attempts; attempt++ {
+		err = fn()
+		if err == nil || !retryable(err) || attempt == d.attempts {
+			break
+		}
+
+		println("Download of", url, "failed, retrying in", wait.String()+":", err.Error())
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wait = min(wait*2, d.maxBackoff)
+	}
+	return err
+}
+
+func (d *downloader) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", d.userAgent)
+	return req, nil
+}
+
+// Get downloads something small into memory
+func (d *downloader) Get(ctx context.Context, url string, maxSize int64) ([]byte, error) {
+	var data []byte
+	err := d.retry(ctx, url, func() error {
+		req, err := d.newRequest(ctx, url)
+		if err != nil {
+			return err
+		}
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return &httpStatusError{resp.Status, resp.StatusCode}
+		}
+
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) > maxSize {
+			return &httpStatusError{"response is too big", 0}
+		}
+		return nil
+	})
+	return data, err
+}
+
+// Download saves url to destPath. it downloads into destPath.part and when
+// an attempt dies halfway the next one asks for the rest with a Range request
+func (d *downloader) Download(ctx context.Context, url, destPath string, onBytes func(done, total int64)) error {
+	_, _, err := d.fetch(ctx, url, destPath, "", onBytes)
+	return err
+}
+
+// errNotModified ends an attempt that got a 304
+var errNotModified = errors.New("not modified")
+
+// fetch is Download with revalidation: with an etag it asks If-None-Match
+// and reports notModified (leaving destPath alone) on a 304. it returns the
+// etag of what it downloaded
+func (d *downloader) fetch(ctx context.Context, url, destPath, etag string, onBytes func(done, total int64)) (newETag string, notModified bool, err error) {
+	partPath := destPath + ".part"
+	os.Remove(partPath)
+
+	// what the first response said about the file, so a resumed request can't
+	// stitch two different versions together
+	var validator string
+
+	err = d.retry(ctx, url, func() error {
+		return d.downloadAttempt(ctx, url, partPath, etag, &validator, &newETag, onBytes)
+	})
+	if errors.Is(err, errNotModified) {
+		os.Remove(partPath)
+		return etag, true, nil
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return "", false, err
+	}
+
+	return newETag, false, os.Rename(partPath, destPath)
+}
+
+func (d *downloader) downloadAttempt(ctx context.Context, url, partPath, ifNoneMatch string, validator, etag *string, onBytes func(done, total int64)) error {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	// cancelled when the connection stalls
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stall := time.AfterFunc(d.stallTimeout, cancel)
+	defer stall.Stop()
+
+	req, err := d.newRequest(attemptCtx, url)
+	if err != nil {
+		return err
+	}
+	if offset > 0 && *validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", *validator)
+	} else if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return stalledOr(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	var total int64
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			// not what we asked for, start over
+			os.Remove(partPath)
+			return &httpStatusError{"server sent an unexpected range", http.StatusServiceUnavailable}
+		}
+		flags |= os.O_APPEND
+		total = size
+		println("Resuming download of", url, "at byte", offset)
+	case http.StatusNotModified:
+		return errNotModified
+	case http.StatusOK:
+		// whole file, either the first try or the server ignored the range
+		flags |= os.O_TRUNC
+		offset = 0
+		if resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+		*etag = resp.Header.Get("ETag")
+		*validator = *etag
+		if *validator == "" || strings.HasPrefix(*validator, "W/") {
+			// weak etags can't be used with If-Range
+			*validator = resp.Header.Get("Last-Modified")
+		}
+	default:
+		return &httpStatusError{resp.Status, resp.StatusCode}
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := &progressWriter{w: out, done: offset, total: total, onBytes: onBytes}
+	_, err = io.Copy(w, &stallReader{r: resp.Body, timer: stall, timeout: d.stallTimeout})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return stalledOr(ctx, err)
+	}
+
+	if total > 0 && w.done != total {
+		return fmt.Errorf("download ended after %d of %d bytes", w.done, total)
+	}
+	return nil
+}
+
+// an attempt cancelled by the stall timer shows up as context.Canceled,
+// which must not look like the user cancelling
+func stalledOr(ctx context.Context, err error) error {
+	if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		return errors.New("download stalled")
+	}
+	return err
+}
+
+// stallReader pushes the stall timer back every time bytes arrive
+type stallReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (s *stallReader) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	if n > 0 {
+		s.timer.Reset(s.timeout)
+	}
+	return n, err
+}
+
+// parseContentRange reads "bytes start-end/size"
+func parseContentRange(v string) (start, size int64, ok bool) {
+	v, found := strings.CutPrefix(v, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rng, sizeStr, found := strings.Cut(v, "/")
+	if !found {
+		return 0, 0, false
+	}
+	startStr, _, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if sizeStr == "*" {
+		return start, 0, true
+	}
+	size, err = strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
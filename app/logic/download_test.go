@@ -0,0 +1,134 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testDownloader is newDownloader without the waiting
+func testDownloader(srv *httptest.Server) *downloader {
+	return &downloader{
+		client:       srv.Client(),
+		userAgent:    defaultUserAgent,
+		attempts:     3,
+		backoff:      time.Millisecond,
+		maxBackoff:   time.Millisecond,
+		stallTimeout: 5 * time.Second,
+	}
+}
+
+var testBody = bytes.Repeat([]byte("0123456789abcdef"), 64<<10) // 1MB
+
+func TestDownloadResumesAfterPartialBody(t *testing.T) {
+	var requests atomic.Int32
+	var gotRange, gotIfRange string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if requests.Add(1) == 1 {
+			// half the file, then the connection drops
+			w.Header().Set("Content-Length", fmt.Sprint(len(testBody)))
+			w.Write(testBody[:len(testBody)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		gotRange, gotIfRange = r.Header.Get("Range"), r.Header.Get("If-Range")
+		http.ServeContent(w, r, "asset", time.Time{}, bytes.NewReader(testBody))
+	}))
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "asset")
+	var lastDone int64
+	err := testDownloader(srv).Download(context.Background(), srv.URL, dest, func(done, total int64) {
+		lastDone = done
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := fmt.Sprintf("bytes=%d-", len(testBody)/2); gotRange != want || gotIfRange != `"v1"` {
+		t.Errorf("second request asked for Range %q If-Range %q, want %q and the etag", gotRange, gotIfRange, want)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testBody) {
+		t.Errorf("got %d bytes, want the %d sent", len(data), len(testBody))
+	}
+	if lastDone != int64(len(testBody)) {
+		t.Errorf("progress ended at %d of %d", lastDone, len(testBody))
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Error(".part file left behind")
+	}
+}
+
+func TestDownloadRetriesRunOut(t *testing.T) {
+	tests := []struct {
+		status   int
+		requests int32
+	}{
+		{http.StatusServiceUnavailable, 3}, // every attempt
+		{http.StatusTooManyRequests, 3},
+		{http.StatusNotFound, 1}, // not worth retrying
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			dest := filepath.Join(t.TempDir(), "asset")
+			err := testDownloader(srv).Download(context.Background(), srv.URL, dest, nil)
+
+			var statusErr *httpStatusError
+			if !errors.As(err, &statusErr) || statusErr.code != tt.status {
+				t.Errorf("got %v, want a %d error", err, tt.status)
+			}
+			if n := requests.Load(); n != tt.requests {
+				t.Errorf("made %d requests, want %d", n, tt.requests)
+			}
+			for _, p := range []string{dest, dest + ".part"} {
+				if _, err := os.Stat(p); !os.IsNotExist(err) {
+					t.Errorf("%s left behind", filepath.Base(p))
+				}
+			}
+		})
+	}
+}
+
+// a partial body every time uses up the attempts too
+func TestDownloadPartialEveryTime(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Length", fmt.Sprint(len(testBody)))
+		w.Write(testBody[:1024])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "asset")
+	if err := testDownloader(srv).Download(context.Background(), srv.URL, dest, nil); err == nil {
+		t.Fatal("a download that never finished succeeded")
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("made %d requests, want 3", n)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("half a file ended up at the destination")
+	}
+}
@@ -0,0 +1,178 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"snail-installer/fuses"
+	"sort"
+	"strings"
+	"time"
+)
+
+// getElectronBinaryPath returns the file electron's fuses live in
+func getElectronBinaryPath(path string) (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		// macOS: the fuses are in the framework, not in Contents/MacOS/Slack
+		return filepath.Join(path, "Contents", "Frameworks", "Electron Framework.framework", "Electron Framework"), nil
+	case "windows":
+		// Windows: the path is already the executable
+		return path, nil
+	case "linux":
+		// Linux: <path>/slack
+		return filepath.Join(path, "slack"), nil
+	default:
+		return "", errors.New("unsupported operating system")
+	}
+}
+
+// InspectFuses reads the fuses of the Slack install without changing anything
+func InspectFuses(path string) (*fuses.Binary, error) {
+	binaryPath, err := getElectronBinaryPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return fuses.Read(binaryPath)
+}
+
+// writeElectronFuse flips one fuse and returns the bytes it replaced. they
+// are also saved to ~/.snail/backups/fuses-backup-<timestamp>.json, a
+// snapshot that can't be saved is only a warning
+func writeElectronFuse(appPath string, fuse fuses.Fuse, enabled bool) (*fuses.Snapshot, error) {
+	binaryPath, err := getElectronBinaryPath(appPath)
+	if err != nil {
+		return nil, err
+	}
+
+	state := fuses.Disabled
+	if enabled {
+		state = fuses.Enabled
+	}
+
+	snapshot, err := fuses.Write(binaryPath, map[fuses.Fuse]fuses.State{fuse: state})
+	if err != nil {
+		return nil, err
+	}
+	println("Set", fuse.String(), "to", state.String(), "in", binaryPath)
+	if err := saveFuseSnapshot(snapshot); err != nil {
+		println("Warning: failed to save fuse backup:", err.Error())
+	}
+
+	pruneFuseSnapshots(GetBackupList())
+	return snapshot, nil
+}
+
+func saveFuseSnapshot(snapshot *fuses.Snapshot) error {
+	dir, err := backupDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	timestamp := snapshot.Taken.Format("20060102-150405")
+	path := filepath.Join(dir, fmt.Sprintf("fuses-backup-%s.json", timestamp))
+	for i := 1; fileExists(path); i++ {
+		path = filepath.Join(dir, fmt.Sprintf("fuses-backup-%s-%d.json", timestamp, i))
+	}
+	return snapshot.Save(path)
+}
+
+type fuseSnapshotFile struct {
+	Path     string
+	Snapshot *fuses.Snapshot
+}
+
+// fuseSnapshots lists the saved snapshots, oldest first
+func fuseSnapshots() []fuseSnapshotFile {
+	dir, err := backupDir()
+	if err != nil {
+		return nil
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var list []fuseSnapshotFile
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, "fuses-backup-") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		snapshot, err := fuses.LoadSnapshot(path)
+		if err != nil {
+			continue
+		}
+		if snapshot.Taken.IsZero() {
+			// saved before snapshots had a time
+			if info, err := file.Info(); err == nil {
+				snapshot.Taken = info.ModTime()
+			}
+		}
+		list = append(list, fuseSnapshotFile{Path: path, Snapshot: snapshot})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Snapshot.Taken.Before(list[j].Snapshot.Taken)
+	})
+	return list
+}
+
+// originalFuses finds the fuses binaryPath had when backup b was taken: the
+// first time we changed them afterwards saved them. nil when they were never
+// changed since
+func originalFuses(binaryPath string, b Backup) *fuseSnapshotFile {
+	taken := backupTaken(b)
+	for _, f := range fuseSnapshots() {
+		if filepath.Clean(f.Snapshot.Path) == filepath.Clean(binaryPath) && !f.Snapshot.Taken.Before(taken) {
+			return &f
+		}
+	}
+	return nil
+}
+
+// backupTaken is when a backup was first made, b.Time moves with LastSeen
+func backupTaken(b Backup) time.Time {
+	if b.Meta != nil && !b.Meta.Created.IsZero() {
+		return b.Meta.Created
+	}
+	return b.Time
+}
+
+// pruneFuseSnapshots goes with the backup retention: the snapshots a kept
+// backup restores from stay, and the newest KeepBackups others too
+func pruneFuseSnapshots(backups []Backup) {
+	snapshots := fuseSnapshots()
+
+	keep := map[string]bool{}
+	for _, b := range backups {
+		taken := backupTaken(b)
+		// one per binary, a backup may be restored to any install it came from
+		seen := map[string]bool{}
+		for _, f := range snapshots {
+			if !f.Snapshot.Taken.Before(taken) && !seen[f.Snapshot.Path] {
+				seen[f.Snapshot.Path] = true
+				keep[f.Path] = true
+			}
+		}
+	}
+	n := keepBackups()
+	for i := len(snapshots) - 1; i >= 0 && i >= len(snapshots)-n; i-- {
+		keep[snapshots[i].Path] = true
+	}
+
+	for _, f := range snapshots {
+		if keep[f.Path] {
+			continue
+		}
+		println("Removing old fuse backup:", f.Path)
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			println("Warning: failed to remove fuse backup:", err.Error())
+		}
+	}
+}
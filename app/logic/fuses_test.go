@@ -0,0 +1,96 @@
+package logic
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"snail-installer/fuses"
+	"strings"
+	"testing"
+)
+
+// fakeSlack makes a folder with an electron binary that has every fuse on,
+// where getElectronBinaryPath looks on linux
+func fakeSlack(t *testing.T) (appPath, binaryPath string) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake slack layout is the linux one")
+	}
+	appPath = t.TempDir()
+	binaryPath = filepath.Join(appPath, "slack")
+	data := []byte("\x7fELF padding ")
+	data = append(data, fuses.Sentinel...)
+	data = append(data, 1, 9)
+	data = append(data, bytes.Repeat([]byte{'1'}, 9)...)
+	if err := os.WriteFile(binaryPath, append(data, " more"...), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return appPath, binaryPath
+}
+
+func TestWriteElectronFuseSavesSnapshot(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	appPath, binaryPath := fakeSlack(t)
+
+	if _, err := writeElectronFuse(appPath, fuses.EnableEmbeddedAsarIntegrityValidation, false); err != nil {
+		t.Fatal(err)
+	}
+	bin, err := fuses.Read(binaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := bin.Wires[0].State(fuses.EnableEmbeddedAsarIntegrityValidation); s != fuses.Disabled {
+		t.Fatalf("fuse is %s after disabling it", s)
+	}
+
+	snapshots := fuseSnapshots()
+	if len(snapshots) != 1 {
+		t.Fatalf("got %d fuse snapshots, want 1", len(snapshots))
+	}
+	if err := snapshots[0].Snapshot.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	bin, _ = fuses.Read(binaryPath)
+	if s, _ := bin.Wires[0].State(fuses.EnableEmbeddedAsarIntegrityValidation); s != fuses.Enabled {
+		t.Errorf("snapshot restored the fuse to %s, it was enabled", s)
+	}
+}
+
+func TestWriteElectronFuseWithoutBackupDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	appPath, _ := fakeSlack(t)
+	// a file where the backups folder should be
+	os.MkdirAll(filepath.Join(home, ".snail"), 0755)
+	os.WriteFile(filepath.Join(home, ".snail", "backups"), nil, 0644)
+
+	if _, err := writeElectronFuse(appPath, fuses.EnableEmbeddedAsarIntegrityValidation, false); err != nil {
+		t.Fatalf("a snapshot that can't be saved failed the write: %s", err)
+	}
+}
+
+func TestPruneFuseSnapshots(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	appPath, _ := fakeSlack(t)
+	AppSettings.KeepBackups = 2
+	defer func() { AppSettings.KeepBackups = 0 }()
+
+	for i := 0; i < 5; i++ {
+		if _, err := writeElectronFuse(appPath, fuses.EnableEmbeddedAsarIntegrityValidation, i%2 == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, _ := backupDir()
+	files, _ := os.ReadDir(dir)
+	n := 0
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), "fuses-backup-") {
+			n++
+		}
+	}
+	if n != 2 {
+		t.Errorf("%d fuse snapshots left, KeepBackups is 2", n)
+	}
+}
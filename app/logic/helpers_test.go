@@ -0,0 +1,67 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"snail-installer/utils"
+	"testing"
+)
+
+// packApp packs files (slash separated path -> contents) into an app.asar
+// in a temp folder and returns its path
+func packApp(t testing.TB, files map[string]string) string {
+	t.Helper()
+	return packAppWith(t, files, utils.PackOptions{})
+}
+
+func packAppWith(t testing.TB, files map[string]string, opts utils.PackOptions) string {
+	t.Helper()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app")
+	for name, data := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	asarPath := filepath.Join(dir, "app.asar")
+	if err := utils.PackFolderToAsar(src, asarPath, opts); err != nil {
+		t.Fatal(err)
+	}
+	return asarPath
+}
+
+// editAsar applies the changes fn makes to the asar at path, in place
+func editAsar(t testing.TB, asarPath string, fn func(app *asarEdits) error) {
+	t.Helper()
+	archive, err := utils.OpenAsar(asarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newAsarEdits(archive)
+	err = fn(app)
+	archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := asarPath + ".new"
+	if err := utils.PatchAsar(asarPath, out, app.edits()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(out, asarPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// patchAsarFile installs the snail patch into the asar at path
+func patchAsarFile(t testing.TB, asarPath string) {
+	t.Helper()
+	editAsar(t, asarPath, func(app *asarEdits) error {
+		_, _, err := patchApp(app, []byte("console.log('snail')\n"))
+		return err
+	})
+}
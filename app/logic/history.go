@@ -0,0 +1,74 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// how many installed assets ~/.snail/installed.json remembers
+const maxInstallHistory = 50
+
+// InstalledAsset records which version of an asset went into slack
+type InstalledAsset struct {
+	Name        string    `json:"name"`
+	SHA256      string    `json:"sha256"`
+	Loader      string    `json:"loader,omitempty"` // manifest version
+	SlackPath   string    `json:"slackPath"`
+	InstalledAt time.Time `json:"installedAt"`
+}
+
+func installHistoryPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".snail", "installed.json"), nil
+}
+
+// InstallHistory lists what earlier installs put into slack, newest last
+func InstallHistory() ([]InstalledAsset, error) {
+	path, err := installHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var history []InstalledAsset
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return history, nil
+}
+
+func recordInstalled(assets ...InstalledAsset) error {
+	path, err := installHistoryPath()
+	if err != nil {
+		return err
+	}
+
+	// a broken file just starts over
+	history, _ := InstallHistory()
+	history = append(history, assets...)
+	if n := len(history); n > maxInstallHistory {
+		history = history[n-maxInstallHistory:]
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
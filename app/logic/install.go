@@ -1,14 +1,16 @@
 package logic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"snail-installer/fuses"
+	"snail-installer/utils"
 	"strings"
 	"time"
 )
@@ -16,13 +18,59 @@ import (
 type InstallOptions struct {
 	TargetPath string
 	TempDir    string
+
+	// optional, install from a snail bundle instead of the asset server
+	BundlePath string
+
+	// optional, Context can cancel the install until the original app.asar
+	// is about to be replaced
+	Context  context.Context
+	Progress ProgressFunc
 }
 
 func InstallSomething(opts InstallOptions) error {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p := newProgress(opts.Progress)
+
+	var appAsarPath string
+	// what the patch changes in app.asar
+	var edits map[string]func([]byte) []byte
+	var bundle *Bundle
+	// whichever signed manifest inject.js came from
+	var manifest *Manifest
+	// main.js and preload.js as put into ~/.snail/internal
+	var loaderAssets []InstalledAsset
+
+	err := p.run(ctx, StepVerify, func() error {
+		if !verifySlackInstall(opts.TargetPath) {
+			p.log("Invalid Slack installation path: %s", opts.TargetPath)
+			return errors.New("invalid Slack installation path")
+		}
 
-	if !verifySlackInstall(opts.TargetPath) {
-		println("Invalid Slack installation path:", opts.TargetPath)
-		return errors.New("invalid Slack installation path")
+		var err error
+		appAsarPath, err = getAppAsarPath(opts.TargetPath)
+		if err != nil {
+			return err
+		}
+		p.log("Using app.asar path: %s", appAsarPath)
+
+		if opts.BundlePath != "" {
+			bundle, err = OpenBundle(opts.BundlePath)
+			if err != nil {
+				return err
+			}
+			p.log("Installing offline from bundle %s (loader %s)", opts.BundlePath, bundle.Manifest.Version)
+		}
+		return nil
+	})
+	if bundle != nil {
+		defer bundle.Close()
+	}
+	if err != nil {
+		return err
 	}
 
 	// create the tempdir
@@ -31,167 +79,303 @@ func InstallSomething(opts InstallOptions) error {
 	if err != nil {
 		return err
 	}
-	println("Created temporary directory at:", tempDir)
+	p.log("Created temporary directory at: %s", tempDir)
 	opts.TempDir = tempDir
 
-	// now copy the .asar file to the temp dir
-
-	var appAsarPath string
-	switch runtime.GOOS {
-	case "darwin":
-		// macOS: Slack.app/Contents/Resources/app.asar
-		appAsarPath = filepath.Join(opts.TargetPath, "Contents", "Resources", "app.asar")
-	case "windows":
-		// Windows: <path>\<executable>.exe -> <path>\resources\app.asar
-		parentDir := filepath.Dir(opts.TargetPath)
-		appAsarPath = filepath.Join(parentDir, "resources", "app.asar")
-	case "linux":
-		// Linux: <path>/resources/app.asar
-		appAsarPath = filepath.Join(opts.TargetPath, "resources", "app.asar")
-	default:
-		return errors.New("unsupported operating system")
-	}
-
-	println("Using app.asar path:", appAsarPath)
-
-	// now copy it to temp_dir + "~/.snail/backups/app-backup-<timestamp>.asar"
-
-	backupAppAsar(appAsarPath)
+	// cleanup temp dir, whatever happens
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			p.log("Warning: failed to remove temporary directory: %s", tempDir)
+		} else {
+			p.log("Removed temporary directory: %s", tempDir)
+		}
+	}()
 
-	// unpack the asar file
+	injectJsPath := filepath.Join(tempDir, "inject.js")
+	newAsarPath := filepath.Join(tempDir, "app-new.asar")
 
-	jsRuntime, err := DetectJsRuntime()
-	if err != nil {
+	// how to undo every change to slack and ~/.snail, anything that fails
+	// or gets cancelled rolls the earlier changes back
+	j := &journal{}
+	fail := func(err error) error {
+		if len(j.entries) == 0 {
+			return err
+		}
+		if rbErr := j.rollback(p); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("rollback failed, Slack may need a reinstall: %w", rbErr))
+		}
+		p.log("Rolled back, Slack was left as it was.")
 		return err
 	}
-	println("Using JavaScript runtime:", jsRuntime.Name)
-
-	err = unpackAsar(appAsarPath, filepath.Join(tempDir, "app-unpacked"), jsRuntime)
 
-	if err != nil {
-		return err
+	steps := []struct {
+		step Step
+		fn   func() error
+	}{
+		{StepBackup, func() error {
+			// a backup of a patched asar is no use for getting slack back,
+			// the one taken when it was first patched is already there
+			version, err := asarPatchVersion(appAsarPath)
+			if err != nil {
+				return err
+			}
+			if version >= 0 {
+				p.log("app.asar already has snail patch v%d, not backing it up", version)
+				return nil
+			}
+
+			// copy it to ~/.snail/backups/app-backup-<timestamp>.asar, without
+			// it there's no going back to the original slack
+			if err := backupAppAsar(appAsarPath, p.bytes); err != nil {
+				return fmt.Errorf("failed to back up app.asar: %w", err)
+			}
+			return nil
+		}},
+		{StepFetchLoader, func() error {
+			if bundle != nil {
+				manifest = bundle.Manifest
+				err := bundle.Extract("inject.js", injectJsPath)
+				if err != nil {
+					return fmt.Errorf("failed to extract inject.js from bundle: %w", err)
+				}
+				p.log("Extracted and verified inject.js to: %s", injectJsPath)
+			} else {
+				// nothing from the server goes into slack unless the signed manifest vouches for it
+				var err error
+				manifest, err = fetchManifest(ctx, AppSettings.ServerURL)
+				if err != nil {
+					return err
+				}
+				p.log("Verified manifest for loader %s", manifest.Version)
+
+				err = downloadVerifiedAsset(ctx, manifest, "inject.js", injectJsPath, p.bytes)
+				if err != nil {
+					return fmt.Errorf("failed to download inject.js: %w", err)
+				}
+				p.log("Downloaded and verified inject.js to: %s", injectJsPath)
+			}
+
+			// the patch only loads ~/.snail/internal/main.js, without it slack
+			// starts without snail
+			var err error
+			loaderAssets, err = provisionRuntime(ctx, p, j, manifest, bundle, tempDir)
+			if err != nil {
+				return fmt.Errorf("failed to set up ~/.snail: %w", err)
+			}
+			return nil
+		}},
+		{StepPatch, func() error {
+			var err error
+			edits, err = patchEntrypoint(p, appAsarPath, injectJsPath)
+			return err
+		}},
+		{StepRepack, func() error {
+			// only the changed files are rewritten, the rest is copied as is
+			err := utils.PatchAsar(appAsarPath, newAsarPath, edits)
+			if err != nil {
+				return fmt.Errorf("failed to repack asar: %w", err)
+			}
+			p.log("Repacked new app.asar to: %s", newAsarPath)
+			return nil
+		}},
+	}
+
+	for _, s := range steps {
+		if err := p.run(ctx, s.step, s.fn); err != nil {
+			return fail(err)
+		}
 	}
-	println("Unpacked app.asar to:", filepath.Join(tempDir, "app-unpacked"))
-
-	// download the inject.js script to the temp dir
 
-	injectJsURL := AppSettings.ServerURL + "assets/inject.js"
-	injectJsPath := filepath.Join(tempDir, "inject.js")
-	err = downloadFile(injectJsURL, injectJsPath)
+	// past this point stopping halfway would leave slack worse off than
+	// finishing, so the rest ignores cancellation
+	ctx = context.Background()
+
+	err = runMutating(ctx, p, j, mutation{
+		targetPath:  opts.TargetPath,
+		appAsarPath: appAsarPath,
+		newAsarPath: newAsarPath,
+		tempDir:     tempDir,
+		fuses: func(j *journal, integrityErr error) error {
+			// only turn the validation fuse off if slack's integrity record
+			// couldn't be written
+			if integrityErr == nil {
+				return nil
+			}
+			p.log("Warning: falling back to disabling asar integrity validation: %s", integrityErr.Error())
+
+			snapshot, err := writeElectronFuse(opts.TargetPath, fuses.EnableEmbeddedAsarIntegrityValidation, false)
+			if snapshot != nil {
+				j.record("electron fuses", snapshot.Restore)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to remove electron fuses: %w", err)
+			}
+			return nil
+		},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to download inject.js: %w", err)
+		return fail(err)
 	}
-	println("Downloaded inject.js to:", injectJsPath)
-
-	// copy inject.js to the unpacked app's directory
 
-	destInjectJsPath := filepath.Join(tempDir, "app-unpacked", "inject.js")
-	err = copyFile(injectJsPath, destInjectJsPath)
-	if err != nil {
-		return fmt.Errorf("failed to copy inject.js to unpacked app: %w", err)
+	installed := append([]InstalledAsset{{
+		Name:   "inject.js",
+		SHA256: manifest.Find("inject.js").SHA256,
+		Loader: manifest.Version,
+	}}, loaderAssets...)
+	for i := range installed {
+		installed[i].SlackPath = opts.TargetPath
+		installed[i].InstalledAt = time.Now()
 	}
-	println("Copied inject.js to unpacked app at:", destInjectJsPath)
-
-	// add required code to index.js to load inject.js
+	if err := recordInstalled(installed...); err != nil {
+		p.log("Warning: failed to record installed assets: %s", err.Error())
+	}
+	return nil
+}
 
-	// if we find a index.js file in the unpacked app directory root (e.g., app-unpacked/index.js) then do that else, ...
-	if _, err := os.Stat(filepath.Join(tempDir, "app-unpacked", "index.js")); err == nil {
-		indexJsPath := filepath.Join(tempDir, "app-unpacked", "index.js")
-		indexJsData, err := os.ReadFile(indexJsPath)
-		if err != nil {
-			return fmt.Errorf("failed to read index.js: %w", err)
-		}
+// mutation is a new app.asar going in place of the current one, and what
+// has to change with it
+type mutation struct {
+	targetPath  string
+	appAsarPath string
+	newAsarPath string
+	// room for the copies rollback needs
+	tempDir string
+	// sets the fuses once the integrity record was updated, integrityErr is
+	// why it couldn't be. it records how to undo what it does in j
+	fuses func(j *journal, integrityErr error) error
+}
 
-		injectCode := "\nrequire('./inject.js');\n"
-		newIndexJsData := append([]byte(injectCode), indexJsData...)
+// runMutating does the steps that change the Slack install, recording in j
+// how to undo each of them. install and restore both go through it
+func runMutating(ctx context.Context, p *progress, j *journal, m mutation) error {
 
-		err = os.WriteFile(indexJsPath, newIndexJsData, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to write modified index.js: %w", err)
-		}
-		println("Modified index.js to load inject.js")
-	} else {
-		// we need to inject in main.bundle.cjs, inside app-unpacked/dist/main.bundle.cjs
-		mainBundlePath := filepath.Join(tempDir, "app-unpacked", "dist", "main.bundle.cjs")
-		mainBundleData, err := os.ReadFile(mainBundlePath)
+	// macOS: codesign rewrites the signature of every binary in the app,
+	// keep them first so rollback can put slack's own signature back.
+	// recorded first so it runs last, after the asar and fuses are back
+	signStarted := false
+	if runtime.GOOS == "darwin" {
+		signature, err := snapshotSignature(m.targetPath, filepath.Join(m.tempDir, "signature"))
 		if err != nil {
-			return fmt.Errorf("failed to read main.bundle.cjs: %w", err)
+			return err
 		}
+		j.record("code signature", func() error {
+			if !signStarted {
+				return nil
+			}
+			return signature.restore()
+		})
+	}
+
+	// the hash of the original header, for putting the integrity record back
+	originalHash, err := utils.AsarHeaderHash(m.appAsarPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash asar header: %w", err)
+	}
 
-		// injecting the whole content of the inject.js at the start of main.bundle.cjs
-		injectJsData, err := os.ReadFile(destInjectJsPath)
+	err = p.run(ctx, StepReplace, func() error {
+		// keep our own copy of the original, the backup in ~/.snail is allowed to fail
+		originalCopyPath := filepath.Join(m.tempDir, "app-original.asar")
+		err := copyFile(m.appAsarPath, originalCopyPath)
 		if err != nil {
-			return fmt.Errorf("failed to read inject.js for injection: %w", err)
+			return fmt.Errorf("failed to keep a copy of app.asar: %w", err)
 		}
 
-		injectCode := "\n" + string(injectJsData) + "\n"
-		newMainBundleData := append([]byte(injectCode), mainBundleData...)
-
-		err = os.WriteFile(mainBundlePath, newMainBundleData, 0644)
+		// replace the original asar file with the new one
+		// (app.asar.unpacked stays as it is, we never touch unpacked files)
+		err = replaceFile(m.newAsarPath, m.appAsarPath, p.bytes)
 		if err != nil {
-			return fmt.Errorf("failed to write modified main.bundle.cjs: %w", err)
+			return fmt.Errorf("failed to replace original app.asar: %w", err)
 		}
-		println("Modified main.bundle.cjs to load inject.js")
+		j.record("app.asar", func() error {
+			return replaceFile(originalCopyPath, m.appAsarPath, nil)
+		})
+		p.log("Replaced app.asar.")
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	// repack the asar file
-
-	newAsarPath := filepath.Join(tempDir, "app-new.asar")
-	err = packAsar(filepath.Join(tempDir, "app-unpacked"), newAsarPath, jsRuntime)
-
+	err = p.run(ctx, StepFuses, func() error {
+		// update the asar integrity hash so the validation fuse can stay on
+		if err := recordAsarIntegrity(j, runtime.GOOS, m.targetPath, m.tempDir, originalHash); err != nil {
+			return err
+		}
+		return m.fuses(j, updateAsarIntegrity(m.targetPath, m.appAsarPath))
+	})
 	if err != nil {
-		return fmt.Errorf("failed to repack asar: %w", err)
+		return err
 	}
-	println("Repacked new app.asar to:", newAsarPath)
 
-	// replace the original asar file with the new one
+	return p.run(ctx, StepSign, func() error {
+		// macOS: code sign the app
+		if runtime.GOOS != "darwin" {
+			return nil
+		}
+		signStarted = true
+		err := codeSignMacOS(m.targetPath)
+		if err != nil {
+			return fmt.Errorf("failed to code sign macOS app: %w", err)
+		}
+		p.log("Code signed macOS app at: %s", m.targetPath)
+		return nil
+	})
+}
 
-	err = copyFile(newAsarPath, appAsarPath)
+// patchEntrypoint works out what makes slack load inject.js, how depends on
+// where package.json's main points (see strategy.go). app.asar isn't touched,
+// the changes come back for utils.PatchAsar
+func patchEntrypoint(p *progress, appAsarPath, injectJsPath string) (map[string]func([]byte) []byte, error) {
+	injectJs, err := os.ReadFile(injectJsPath)
 	if err != nil {
-		return fmt.Errorf("failed to replace original app.asar: %w", err)
+		return nil, fmt.Errorf("failed to read inject.js: %w", err)
 	}
-	println("Replaced original app.asar with modified version.")
 
-	// cleanup temp dir
-
-	err = os.RemoveAll(tempDir)
+	archive, err := utils.OpenAsar(appAsarPath)
 	if err != nil {
-		println("Warning: failed to remove temporary directory:", tempDir)
-	} else {
-		println("Removed temporary directory:", tempDir)
+		return nil, fmt.Errorf("failed to read %s: %w", appAsarPath, err)
 	}
+	defer archive.Close()
 
-	// remove electron fuses
-	err = removeElectronFuses(opts.TargetPath, jsRuntime)
-
+	app := newAsarEdits(archive)
+	strategy, version, err := patchApp(app, injectJs)
 	if err != nil {
-		return fmt.Errorf("failed to remove electron fuses: %w", err)
+		return nil, err
 	}
-
-	// macOS: code sign the app
-	if runtime.GOOS == "darwin" {
-		err = codeSignMacOS(opts.TargetPath)
-		if err != nil {
-			return fmt.Errorf("failed to code sign macOS app: %w", err)
-		}
-		println("Code signed macOS app at:", opts.TargetPath)
+	switch {
+	case version == PatchVersion:
+		p.log("Reinstalling snail patch v%d", version)
+	case version >= 0:
+		p.log("Upgrading snail patch v%d to v%d", version, PatchVersion)
 	}
+	p.log("Patched slack to load inject.js (%s strategy)", strategy.Name())
+	return app.edits(), nil
+}
 
-	return nil
+func getAppAsarPath(path string) (string, error) {
+	return appAsarPathFor(runtime.GOOS, path)
 }
 
-func verifySlackInstall(path string) bool {
-	var appAsarPath string
-	switch runtime.GOOS {
+func appAsarPathFor(goos, path string) (string, error) {
+	switch goos {
 	case "darwin":
-		appAsarPath = filepath.Join(path, "Contents", "Resources", "app.asar")
+		// macOS: Slack.app/Contents/Resources/app.asar
+		return filepath.Join(path, "Contents", "Resources", "app.asar"), nil
 	case "windows":
-		// remove the last /<executable>.exe + add /resources/app.asar
+		// Windows: <path>\<executable>.exe -> <path>\resources\app.asar
 		parentDir := filepath.Dir(path)
-		appAsarPath = filepath.Join(parentDir, "resources", "app.asar")
+		return filepath.Join(parentDir, "resources", "app.asar"), nil
 	case "linux":
-		appAsarPath = filepath.Join(path, "resources", "app.asar")
+		// Linux: <path>/resources/app.asar
+		return filepath.Join(path, "resources", "app.asar"), nil
 	default:
+		return "", errors.New("unsupported operating system")
+	}
+}
+
+func verifySlackInstall(path string) bool {
+	appAsarPath, err := getAppAsarPath(path)
+	if err != nil {
 		return false
 	}
 
@@ -212,143 +396,75 @@ func createTempDir() (string, error) {
 	return tempDir, nil
 }
 
-func backupAppAsar(appAsarPath string) error {
-
-	// check if app.asar exists
-	if _, err := os.Stat(appAsarPath); os.IsNotExist(err) {
-		return fmt.Errorf("app.asar not found at %s", appAsarPath)
-	}
-
-	// create backup directory: ~/.snail/backups
-	homeDir, err := os.UserHomeDir()
+// replaceFile swaps dst for a copy of src without ever leaving a half written
+// dst behind: the copy goes to a temp file next to it, which is renamed over dst
+func replaceFile(src, dst string, onBytes func(done, total int64)) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-*")
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+		return err
 	}
+	tmpPath := tmp.Name()
+	tmp.Close()
 
-	backupDir := filepath.Join(homeDir, ".snail", "backups")
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return fmt.Errorf("failed to create backup directory: %w", err)
+	err = copyFileWithProgress(src, tmpPath, onBytes)
+	if err == nil {
+		err = syncFile(tmpPath)
 	}
-
-	timestamp := time.Now().Format("20060102-150405")
-	backupPath := filepath.Join(backupDir, fmt.Sprintf("app-backup-%s.asar", timestamp))
-
-	if err := copyFile(appAsarPath, backupPath); err != nil {
-		return fmt.Errorf("failed to backup app.asar: %w", err)
+	if err == nil {
+		err = os.Rename(tmpPath, dst)
 	}
-
-	fmt.Println("Backup created at:", backupPath)
-	return nil
-}
-
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
 	if err != nil {
+		os.Remove(tmpPath)
 		return err
 	}
-	defer in.Close()
-
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		cerr := out.Close()
-		if err == nil {
-			err = cerr
-		}
-	}()
-
-	if _, err = io.Copy(out, in); err != nil {
-		return err
-	}
+	return nil
+}
 
-	info, err := os.Stat(src)
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
 	if err != nil {
 		return err
 	}
-	return os.Chmod(dst, info.Mode())
-}
-
-func getJsRuntimeInstalled() (bool, string) {
-	// check for npm or bun and prefer the latter
-
-	if runtime.GOOS == "windows" {
-		// Windows, return "bun" or "npm" with nothing else
-		if _, err := exec.LookPath("bun.exe"); err == nil {
-			return true, "bun"
-		}
-		if _, err := exec.LookPath("npm.cmd"); err == nil {
-			return true, "npm"
-		}
-	} else {
-		// macOS/Linux
-		if _, err := exec.LookPath("bun"); err == nil {
-			return true, "bun"
-		}
-		if _, err := exec.LookPath("npm"); err == nil {
-			return true, "npm"
-		}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-
-	return false, ""
+	return err
 }
 
-func unpackAsar(asarPath, destDir string, rt *JsRuntime) error {
-	cmd := exec.Command(
-		rt.Exec,
-		"asar",
-		"extract",
-		asarPath,
-		destDir,
-	)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("asar extract failed: %s, %w", output, err)
-	}
-	return nil
+func copyFile(src, dst string) error {
+	return copyFileWithProgress(src, dst, nil)
 }
 
-func packAsar(srcDir, asarPath string, rt *JsRuntime) error {
-	cmd := exec.Command(
-		rt.Exec,
-		"asar",
-		"pack",
-		srcDir,
-		asarPath,
-	)
-
-	output, err := cmd.CombinedOutput()
+func copyFileWithProgress(src, dst string, onBytes func(done, total int64)) (err error) {
+	in, err := os.Open(src)
 	if err != nil {
-		return fmt.Errorf("asar pack failed: %s, %w", output, err)
+		return err
 	}
-	return nil
-}
+	defer in.Close()
 
-func downloadFile(url, destPath string) error {
-	resp, err := http.Get(url)
+	info, err := in.Stat()
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download file: %s", resp.Status)
-	}
 
-	out, err := os.Create(destPath)
+	out, err := os.Create(dst)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer func() {
+		cerr := out.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
 
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
+	w := &progressWriter{w: out, total: info.Size(), onBytes: onBytes}
+	if _, err = io.Copy(w, in); err != nil {
 		return err
 	}
 
-	return nil
+	return os.Chmod(dst, info.Mode())
 }
 
 func codeSignMacOS(appPath string) error {
@@ -372,83 +488,9 @@ func codeSignMacOS(appPath string) error {
 		cmd := exec.Command("tccutil", "reset", perm, bunleID)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
-			fmt.Printf("Warning: failed to reset %s permission: %s, %s\n", perm, string(output), err)
+			println("Warning: failed to reset", perm, "permission:", strings.TrimSpace(string(output)), err.Error())
 		}
 	}
 
 	return nil
 }
-
-func removeElectronFuses(appPath string, rt *JsRuntime) error {
-	cmd := exec.Command(
-		rt.Exec,
-		"@electron/fuses",
-		"write",
-		"--app",
-		appPath,
-		"EnableEmbeddedAsarIntegrityValidation=off",
-	)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("electron fuses failed: %s, %w", output, err)
-	}
-	return nil
-}
-
-type JsRuntime struct {
-	Name string // "bun" or "npm"
-	Exec string // "bunx" or "npx"
-}
-
-func DetectJsRuntime() (*JsRuntime, error) {
-	ensureCommonPaths()
-
-	// Prefer bun
-	if p, err := exec.LookPath(cmdName("bunx")); err == nil {
-		return &JsRuntime{
-			Name: "bun",
-			Exec: p,
-		}, nil
-	}
-
-	// Fallback to npm
-	if p, err := exec.LookPath(cmdName("npx")); err == nil {
-		return &JsRuntime{
-			Name: "npm",
-			Exec: p,
-		}, nil
-	}
-
-	return nil, errors.New("no JavaScript runtime found (bunx or npx)")
-}
-
-func ensureCommonPaths() {
-	path := os.Getenv("PATH")
-
-	add := func(p string) {
-		if p == "" {
-			return
-		}
-		if !strings.Contains(path, p) {
-			path += string(os.PathListSeparator) + p
-		}
-	}
-
-	add("/usr/local/bin")
-	add("/opt/homebrew/bin")
-	add(filepath.Join(os.Getenv("HOME"), ".bun", "bin"))
-
-	if runtime.GOOS == "windows" {
-		add(filepath.Join(os.Getenv("USERPROFILE"), "AppData", "Local", "bun", "bin"))
-	}
-
-	os.Setenv("PATH", path)
-}
-
-func cmdName(name string) string {
-	if runtime.GOOS == "windows" {
-		return name + ".cmd"
-	}
-	return name
-}
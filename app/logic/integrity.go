@@ -0,0 +1,67 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"snail-installer/utils"
+)
+
+// updateAsarIntegrity points electron's asar integrity check at the header of
+// the app.asar currently on disk, so the validation fuse can stay on
+func updateAsarIntegrity(appPath, appAsarPath string) error {
+	hash, err := utils.AsarHeaderHash(appAsarPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash asar header: %w", err)
+	}
+	return writeAsarIntegrity(appPath, hash)
+}
+
+// writeAsarIntegrity sets the hash in Slack's integrity record
+func writeAsarIntegrity(appPath, hash string) error {
+	return writeAsarIntegrityFor(runtime.GOOS, appPath, hash)
+}
+
+func writeAsarIntegrityFor(goos, appPath, hash string) error {
+	var err error
+	switch goos {
+	case "darwin":
+		// macOS: Contents/Info.plist, keyed by the path relative to Contents
+		err = utils.SetPlistAsarIntegrity(infoPlistPath(appPath), "Resources/app.asar", hash)
+	case "windows":
+		// Windows: INTEGRITY/ELECTRONASAR resource of the executable
+		err = utils.SetPEAsarIntegrity(appPath, hash)
+	case "linux":
+		// electron doesn't validate asar integrity on linux
+		return nil
+	default:
+		return errors.New("unsupported operating system")
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write asar integrity: %w", err)
+	}
+	println("Updated asar integrity hash to:", hash)
+	return nil
+}
+
+func infoPlistPath(appPath string) string {
+	return filepath.Join(appPath, "Contents", "Info.plist")
+}
+
+// recordAsarIntegrity journals the integrity record before it changes.
+// Info.plist is sealed by the code signature, so it comes back byte for
+// byte from a copy in keepDir. the windows record is a hash overwritten in
+// place by one of the same length, writing originalHash back undoes it
+func recordAsarIntegrity(j *journal, goos, appPath, keepDir, originalHash string) error {
+	switch goos {
+	case "darwin":
+		return j.recordFile(infoPlistPath(appPath), keepDir)
+	case "windows":
+		j.record("asar integrity", func() error {
+			return writeAsarIntegrityFor(goos, appPath, originalHash)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// journal remembers how to undo every change made to the Slack install, so a
+// failed install can put things back the way they were
+type journal struct {
+	entries []journalEntry
+}
+
+type journalEntry struct {
+	what string
+	undo func() error
+}
+
+// record goes right before a change that can fail halfway (so that still gets
+// undone), or right after one that either happens completely or not at all
+func (j *journal) record(what string, undo func() error) {
+	j.entries = append(j.entries, journalEntry{what, undo})
+}
+
+// rollback undoes everything in reverse order. it keeps going when an undo
+// fails, one broken step shouldn't stop the rest from being put back
+func (j *journal) rollback(p *progress) error {
+	var errs []error
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		e := j.entries[i]
+		p.log("Rolling back: %s", e.what)
+		if err := e.undo(); err != nil {
+			p.log("Warning: failed to roll back %s: %s", e.what, err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", e.what, err))
+		}
+	}
+	j.entries = nil
+	return errors.Join(errs...)
+}
+
+// recordFile keeps a copy of path in keepDir before it gets changed, so
+// rollback can put it back, or remove it when it didn't exist yet
+func (j *journal) recordFile(path, keepDir string) error {
+	if !fileExists(path) {
+		j.record(path, func() error {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		})
+		return nil
+	}
+
+	keep := filepath.Join(keepDir, fmt.Sprintf("journal-%d-%s", len(j.entries), filepath.Base(path)))
+	if err := copyFile(path, keep); err != nil {
+		return fmt.Errorf("failed to keep a copy of %s: %w", path, err)
+	}
+	j.record(path, func() error {
+		return replaceFile(keep, path, nil)
+	})
+	return nil
+}
+
+// recordDir makes rollback remove dir if it doesn't exist yet, as long as
+// it's empty again by then
+func (j *journal) recordDir(dir string) {
+	if fileExists(dir) {
+		return
+	}
+	j.record(dir, func() error {
+		os.Remove(dir)
+		return nil
+	})
+}
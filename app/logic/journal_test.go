@@ -0,0 +1,128 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// what provisionRuntime records has to come back out on rollback: changed
+// files as they were, new files and folders gone
+func TestJournalRollsBackFiles(t *testing.T) {
+	home := t.TempDir()
+	keep := t.TempDir()
+
+	existing := filepath.Join(home, "config.json")
+	if err := os.WriteFile(existing, []byte(`{"mine":true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newDir := filepath.Join(home, "internal")
+	newFile := filepath.Join(newDir, "main.js")
+
+	j := &journal{}
+	if err := j.recordFile(existing, keep); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte(`{"mine":false}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j.recordDir(newDir)
+	if err := os.MkdirAll(newDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.recordFile(newFile, keep); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, []byte("loader"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.rollback(newProgress(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"mine":true}` {
+		t.Errorf("config.json is %s after rollback", data)
+	}
+	if fileExists(newDir) {
+		t.Errorf("%s is still there after rollback", newDir)
+	}
+}
+
+// a dir that got something we didn't record in it stays
+func TestJournalKeepsDirWithOtherFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "plugins")
+
+	j := &journal{}
+	j.recordDir(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "someone-elses.js"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.rollback(newProgress(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(filepath.Join(dir, "someone-elses.js")) {
+		t.Error("rollback removed a file it didn't create")
+	}
+}
+
+// Info.plist is sealed by slack's signature, rollback has to leave it byte
+// for byte as it was, whatever layout it had and whether or not it had an
+// integrity record before
+func TestJournalRollsBackInfoPlist(t *testing.T) {
+	tests := []struct {
+		name, plist string
+	}{
+		{"no record", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n<plist version=\"1.0\">\r\n<dict>\r\n  <key>CFBundleName</key>\r\n  <string>Slack</string>\r\n</dict>\r\n</plist>\r\n"},
+		{"record", "<plist version=\"1.0\">\n<dict>\n    <key>ElectronAsarIntegrity</key>\n    <dict>\n        <key>Resources/app.asar</key>\n        <dict><key>algorithm</key><string>SHA256</string><key>hash</key><string>1234</string></dict>\n    </dict>\n</dict>\n</plist>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appPath := filepath.Join(t.TempDir(), "Slack.app")
+			plistPath := infoPlistPath(appPath)
+			if err := os.MkdirAll(filepath.Dir(plistPath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(plistPath, []byte(tt.plist), 0640); err != nil {
+				t.Fatal(err)
+			}
+
+			j := &journal{}
+			if err := recordAsarIntegrity(j, "darwin", appPath, t.TempDir(), "1234"); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeAsarIntegrityFor("darwin", appPath, "abcd"); err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := os.ReadFile(plistPath); string(data) == tt.plist {
+				t.Fatal("the integrity write didn't change Info.plist")
+			}
+
+			if err := j.rollback(newProgress(nil)); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(plistPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.plist {
+				t.Errorf("Info.plist after rollback:\n%s\nwant\n%s", data, tt.plist)
+			}
+			info, err := os.Stat(plistPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0640 {
+				t.Errorf("Info.plist is %v after rollback, was 0640", info.Mode().Perm())
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package logic
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// manifestPublicKey is the public half of the release key manifest.json is
+// signed with, set at build time with
+// -ldflags "-X snail-installer/logic.manifestPublicKey=<base64 key>".
+// without it nothing from a server is trusted
+var manifestPublicKey = ""
+
+// manifests are a few hundred bytes, anything near this is not one
+const maxManifestSize = 1 << 20
+
+var ErrBadSignature = errors.New("manifest signature does not match, refusing to install anything from this server")
+
+type Manifest struct {
+	Version string          `json:"version"`
+	Created string          `json:"created"`
+	Assets  []ManifestAsset `json:"assets"`
+}
+
+type ManifestAsset struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// parseManifest checks sig (base64, as served in manifest.json.sig) over the
+// exact bytes of manifest.json before looking inside
+func parseManifest(data, sig []byte, pub ed25519.PublicKey) (*Manifest, error) {
+	rawSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(pub, data, rawSig) {
+		return nil, ErrBadSignature
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest.json: %w", err)
+	}
+	return &m, nil
+}
+
+func (m *Manifest) Find(name string) *ManifestAsset {
+	for i := range m.Assets {
+		if m.Assets[i].Name == name {
+			return &m.Assets[i]
+		}
+	}
+	return nil
+}
+
+// VerifyFile checks a file against the manifest entry for name
+func (m *Manifest) VerifyFile(name, path string) error {
+	asset := m.Find(name)
+	if asset == nil {
+		return fmt.Errorf("%s is not in the signed manifest", name)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+
+	if n != asset.Size {
+		return fmt.Errorf("%s is %d bytes, the manifest says %d", name, n, asset.Size)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != asset.SHA256 {
+		return fmt.Errorf("%s has sha256 %s, the manifest says %s", name, got, asset.SHA256)
+	}
+	return nil
+}
+
+func manifestKey() (ed25519.PublicKey, error) {
+	if manifestPublicKey == "" {
+		return nil, errors.New("this installer was built without a manifest key, it can't verify anything from the server")
+	}
+	key, err := base64.StdEncoding.DecodeString(manifestPublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("the manifest key this installer was built with is not a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// fetchManifest downloads and verifies the manifest of the asset server
+func fetchManifest(ctx context.Context, serverURL string) (*Manifest, error) {
+	pub, err := manifestKey()
+	if err != nil {
+		return nil, err
+	}
+	data, err := fetchSmall(ctx, serverURL+"assets/manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download manifest.json: %w", err)
+	}
+	sig, err := fetchSmall(ctx, serverURL+"assets/manifest.json.sig")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download manifest.json.sig: %w", err)
+	}
+	return parseManifest(data, sig, pub)
+}
+
+// fetchSmall goes through the cache too, without the manifest a cached
+// inject.js would be no use offline
+func fetchSmall(ctx context.Context, url string) ([]byte, error) {
+	return cachedGet(ctx, url, maxManifestSize)
+}
+
+// downloadVerifiedAsset downloads assets/<name> and only keeps it if it
+// matches the signed manifest
+func downloadVerifiedAsset(ctx context.Context, m *Manifest, name, destPath string, onBytes func(done, total int64)) error {
+	if m.Find(name) == nil {
+		return fmt.Errorf("%s is not in the signed manifest", name)
+	}
+
+	err := cachedDownload(ctx, AppSettings.ServerURL+"assets/"+name, destPath, onBytes)
+	if err != nil {
+		return err
+	}
+
+	if err := m.VerifyFile(name, destPath); err != nil {
+		os.Remove(destPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package logic
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testKey makes a key pair and builds the installer with its public half
+// for the rest of the test
+func testKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := manifestPublicKey
+	manifestPublicKey = base64.StdEncoding.EncodeToString(pub)
+	t.Cleanup(func() { manifestPublicKey = old })
+	return priv
+}
+
+// signManifest is what the webserver's sign command writes for files
+func signManifest(t *testing.T, priv ed25519.PrivateKey, files map[string]string) (manifest, sig []byte) {
+	t.Helper()
+	m := Manifest{Version: "v1.0.0", Created: "2026-01-01T00:00:00Z"}
+	for name, data := range files {
+		sum := sha256.Sum256([]byte(data))
+		m.Assets = append(m.Assets, ManifestAsset{Name: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, manifest)) + "\n")
+	return manifest, sig
+}
+
+func TestParseManifestBadSignature(t *testing.T) {
+	priv := testKey(t)
+	data, sig := signManifest(t, priv, map[string]string{"inject.js": "1"})
+	pub, err := manifestKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseManifest(data, sig, pub); err != nil {
+		t.Fatalf("good manifest: %s", err)
+	}
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	edited := append([]byte{}, data...)
+	edited[len(edited)-2] = ' '
+
+	tests := []struct {
+		name string
+		data []byte
+		sig  []byte
+		pub  ed25519.PublicKey
+	}{
+		{"other key", data, sig, other},
+		{"edited manifest", edited, sig, pub},
+		{"garbage signature", data, []byte("not base64!"), pub},
+		{"empty signature", data, nil, pub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseManifest(tt.data, tt.sig, tt.pub); !errors.Is(err, ErrBadSignature) {
+				t.Errorf("got %v, want ErrBadSignature", err)
+			}
+		})
+	}
+}
+
+func TestVerifyFileTampered(t *testing.T) {
+	priv := testKey(t)
+	data, sig := signManifest(t, priv, map[string]string{"main.js": "console.log('main')\n"})
+	pub, _ := manifestKey()
+	m, err := parseManifest(data, sig, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		name, file, data string
+		ok               bool
+	}{
+		{"as signed", "main.js", "console.log('main')\n", true},
+		{"same size", "main.js", "console.log('evil')\n", false},
+		{"other size", "main.js", "console.log('evil');\n", false},
+		{"not listed", "preload.js", "console.log('main')\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := m.VerifyFile(tt.file, path)
+			if (err == nil) != tt.ok {
+				t.Errorf("VerifyFile = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+// an installer built without a key trusts nothing
+func TestFetchManifestWithoutKey(t *testing.T) {
+	old := manifestPublicKey
+	manifestPublicKey = ""
+	defer func() { manifestPublicKey = old }()
+
+	if _, err := fetchManifest(context.Background(), "http://127.0.0.1:1/"); err == nil {
+		t.Error("fetched a manifest without a key to check it")
+	}
+}
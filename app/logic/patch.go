@@ -0,0 +1,117 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"snail-installer/utils"
+	"strconv"
+)
+
+// PatchVersion goes up whenever the code we add to slack's entrypoint
+// changes, installing over an older patch swaps it for this one
+const PatchVersion = 1
+
+// legacyPatchVersion is what patches from before the markers count as
+const legacyPatchVersion = 0
+
+// what we add gets wrapped in these so it can be found and taken out again
+const (
+	patchBeginPrefix = "/* snail-patch v"
+	patchBeginSuffix = " */\n"
+	patchEnd         = "/* snail-patch end */\n"
+)
+
+// prepended to index.js by older installers, without markers
+const legacyInjectRequireCode = "\nrequire('./inject.js');\n"
+
+// markPatch wraps code in the markers for the current version
+func markPatch(code string) []byte {
+	return []byte(fmt.Sprintf("%s%d%s%s\n%s", patchBeginPrefix, PatchVersion, patchBeginSuffix, code, patchEnd))
+}
+
+// stripPatch peels every snail block off the start of an entrypoint and
+// returns what's left with the version of the outermost one, -1 if there was
+// none. injectJs is the inject.js that shipped with the patch, it's the only
+// way to spot the unmarked copies older installers inlined into main.bundle.cjs
+func stripPatch(data, injectJs []byte) ([]byte, int) {
+	version := -1
+	found := func(v int) {
+		if version < 0 {
+			version = v
+		}
+	}
+
+	for {
+		if v, rest, ok := cutMarkedPatch(data); ok {
+			found(v)
+			data = rest
+			continue
+		}
+
+		// installing twice used to stack these
+		if bytes.HasPrefix(data, []byte(legacyInjectRequireCode)) {
+			found(legacyPatchVersion)
+			data = data[len(legacyInjectRequireCode):]
+			continue
+		}
+		if len(injectJs) > 0 {
+			legacy := "\n" + string(injectJs) + "\n"
+			if bytes.HasPrefix(data, []byte(legacy)) {
+				found(legacyPatchVersion)
+				data = data[len(legacy):]
+				continue
+			}
+		}
+
+		return data, version
+	}
+}
+
+func cutMarkedPatch(data []byte) (int, []byte, bool) {
+	rest, ok := bytes.CutPrefix(data, []byte(patchBeginPrefix))
+	if !ok {
+		return 0, nil, false
+	}
+
+	num, rest, ok := bytes.Cut(rest, []byte(patchBeginSuffix))
+	if !ok {
+		return 0, nil, false
+	}
+	v, err := strconv.Atoi(string(num))
+	if err != nil {
+		return 0, nil, false
+	}
+
+	_, rest, ok = bytes.Cut(rest, []byte(patchEnd))
+	if !ok {
+		return 0, nil, false
+	}
+	return v, rest, true
+}
+
+// asarPatchVersion looks at the entrypoint inside an asar without unpacking
+// it, -1 means slack is untouched
+func asarPatchVersion(asarPath string) (int, error) {
+	archive, err := utils.OpenAsar(asarPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", asarPath, err)
+	}
+	defer archive.Close()
+
+	return appPatchVersion(asarApp{archive})
+}
+
+// asarPatchStrategy names the strategy for an asar, empty if there is none
+func asarPatchStrategy(asarPath string) string {
+	archive, err := utils.OpenAsar(asarPath)
+	if err != nil {
+		return ""
+	}
+	defer archive.Close()
+
+	strategy, _, err := choosePatchStrategy(asarApp{archive})
+	if err != nil {
+		return ""
+	}
+	return strategy.Name()
+}
@@ -0,0 +1,127 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+type Step string
+
+const (
+	StepVerify      Step = "verify"
+	StepBackup      Step = "backup"
+	StepFetchLoader Step = "fetch loader"
+	StepPatch       Step = "patch entrypoint"
+	StepUnpatch     Step = "remove patch"
+	StepRepack      Step = "repack"
+	StepReplace     Step = "replace"
+	StepFuses       Step = "fuses"
+	StepSign        Step = "sign"
+)
+
+// InstallSteps is every step InstallSomething goes through, in order
+var InstallSteps = []Step{
+	StepVerify,
+	StepBackup,
+	StepFetchLoader,
+	StepPatch,
+	StepRepack,
+	StepReplace,
+	StepFuses,
+	StepSign,
+}
+
+// UninstallSteps is every step Uninstall goes through, in order
+var UninstallSteps = []Step{
+	StepVerify,
+	StepUnpatch,
+	StepRepack,
+	StepReplace,
+	StepFuses,
+	StepSign,
+}
+
+type EventKind int
+
+const (
+	EventStart EventKind = iota
+	EventFinish
+	EventFail
+	EventBytes // Done/Total bytes within the current step
+	EventLog
+)
+
+type ProgressEvent struct {
+	Step    Step
+	Kind    EventKind
+	Done    int64
+	Total   int64 // 0 if unknown
+	Message string
+	Err     error
+}
+
+// ProgressFunc gets called from whatever goroutine the install runs on
+type ProgressFunc func(ProgressEvent)
+
+type progress struct {
+	fn   ProgressFunc
+	step Step
+}
+
+func newProgress(fn ProgressFunc) *progress {
+	return &progress{fn: fn}
+}
+
+func (p *progress) emit(ev ProgressEvent) {
+	if p.fn != nil {
+		ev.Step = p.step
+		p.fn(ev)
+	}
+}
+
+// log prints like before and also hands the line to the ui
+func (p *progress) log(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	println(msg)
+	p.emit(ProgressEvent{Kind: EventLog, Message: msg})
+}
+
+// bytes is the onBytes callback for copies and downloads in the current step
+func (p *progress) bytes(done, total int64) {
+	p.emit(ProgressEvent{Kind: EventBytes, Done: done, Total: total})
+}
+
+// run does one step, it doesn't start if ctx is already cancelled
+func (p *progress) run(ctx context.Context, step Step, fn func() error) error {
+	p.step = step
+	if err := ctx.Err(); err != nil {
+		p.emit(ProgressEvent{Kind: EventFail, Err: err})
+		return err
+	}
+
+	p.emit(ProgressEvent{Kind: EventStart})
+	if err := fn(); err != nil {
+		p.emit(ProgressEvent{Kind: EventFail, Err: err})
+		return err
+	}
+	p.emit(ProgressEvent{Kind: EventFinish})
+	return nil
+}
+
+// progressWriter counts what goes through it
+type progressWriter struct {
+	w       io.Writer
+	done    int64
+	total   int64
+	onBytes func(done, total int64)
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.done += int64(n)
+	if pw.onBytes != nil {
+		pw.onBytes(pw.done, pw.total)
+	}
+	return n, err
+}
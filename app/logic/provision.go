@@ -0,0 +1,154 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the patch in slack only loads ~/.snail/internal/main.js, everything else
+// snail needs at runtime lives next to it:
+//
+//	~/.snail/internal/main.js, preload.js   the loader
+//	~/.snail/plugins/, themes/
+//	~/.snail/config.json
+
+// loader files ~/.snail/internal needs for slack to start with snail
+var loaderFiles = []string{"main.js", "preload.js"}
+
+func snailDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".snail"), nil
+}
+
+// provisionRuntime sets up ~/.snail for the loader in m, taking the files
+// from b when installing from a bundle and from the server otherwise.
+// it returns what it put into ~/.snail/internal, for the install history.
+// every change is recorded in j (keeping copies in tempDir) so a failed
+// install takes them back too
+func provisionRuntime(ctx context.Context, p *progress, j *journal, m *Manifest, b *Bundle, tempDir string) ([]InstalledAsset, error) {
+	dir, err := snailDir()
+	if err != nil {
+		return nil, err
+	}
+	internalDir := filepath.Join(dir, "internal")
+	// parents first, so rollback removes them last
+	for _, d := range []string{dir, internalDir, filepath.Join(dir, "plugins"), filepath.Join(dir, "themes")} {
+		j.recordDir(d)
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	var installed []InstalledAsset
+	for _, name := range loaderFiles {
+		// verify before anything in ~/.snail gets touched
+		tmp := filepath.Join(tempDir, "loader-"+name)
+		if b != nil {
+			err = b.Extract(name, tmp)
+		} else {
+			err = downloadVerifiedAsset(ctx, m, name, tmp, p.bytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", name, err)
+		}
+
+		dest := filepath.Join(internalDir, name)
+		if err := j.recordFile(dest, tempDir); err != nil {
+			return nil, err
+		}
+		if err := replaceFile(tmp, dest, nil); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		p.log("Installed %s", dest)
+
+		installed = append(installed, InstalledAsset{
+			Name:   name,
+			SHA256: m.Find(name).SHA256,
+			Loader: m.Version,
+		})
+	}
+
+	var template []byte
+	if b != nil {
+		template, err = b.Config()
+	} else {
+		template, err = fetchSmall(ctx, AppSettings.ServerURL+"assets/config.json")
+	}
+	if err != nil {
+		// the loader copes with missing keys, so this is not worth failing over
+		p.log("Warning: no default config.json (%s), only setting serverUrl and loaderVersion", err.Error())
+		template = nil
+	}
+
+	configPath := filepath.Join(dir, "config.json")
+	for _, f := range []string{configPath, configPath + ".bak"} {
+		if err := j.recordFile(f, tempDir); err != nil {
+			return nil, err
+		}
+	}
+	if err := mergeConfig(configPath, template, m.Version); err != nil {
+		return nil, fmt.Errorf("failed to update %s: %w", configPath, err)
+	}
+	p.log("Updated %s", configPath)
+
+	return installed, nil
+}
+
+// mergeConfig writes config.json from the server's template without losing
+// anything the user changed: keys they have win over the template, except
+// serverUrl and loaderVersion which always follow the installer
+func mergeConfig(configPath string, template []byte, loaderVersion string) error {
+	config := map[string]any{
+		"pluginsEnabled": []any{},
+		"themesEnabled":  []any{},
+	}
+
+	if len(template) > 0 {
+		var defaults map[string]any
+		if err := json.Unmarshal(template, &defaults); err != nil {
+			return fmt.Errorf("default config.json is not valid JSON: %w", err)
+		}
+		for k, v := range defaults {
+			config[k] = v
+		}
+	}
+
+	existing, err := os.ReadFile(configPath)
+	switch {
+	case err == nil:
+		var user map[string]any
+		if err := json.Unmarshal(existing, &user); err != nil {
+			// don't throw away a config someone broke by hand, keep it next to the new one
+			println("Warning: config.json is not valid JSON, keeping it as config.json.bak:", err.Error())
+			if err := os.WriteFile(configPath+".bak", existing, 0644); err != nil {
+				return err
+			}
+		}
+		for k, v := range user {
+			config[k] = v
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	// the loader builds urls as serverUrl + "/assets/...", settings keep the slash
+	config["serverUrl"] = strings.TrimRight(AppSettings.ServerURL, "/")
+	config["loaderVersion"] = loaderVersion
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := configPath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, configPath)
+}
@@ -1,42 +1,196 @@
 package logic
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	"time"
+	"path/filepath"
+	"snail-installer/fuses"
+	"snail-installer/utils"
 )
 
-type Backup struct {
-	Filepath string
-	Time     time.Time
-}
-
+// RestoreBackup copies a backup asar (src) over the app.asar of the Slack
+// install at dest, after saving the current app.asar as a new backup. the
+// fuses go back to how they were when the backup was taken, and anything
+// that fails rolls the restore back like a failed install
 func RestoreBackup(src, dest string) error {
-	// nothing for now
+
+	if !verifySlackInstall(dest) {
+		return fmt.Errorf("invalid Slack installation path: %s", dest)
+	}
+
+	appAsarPath, err := getAppAsarPath(dest)
+	if err != nil {
+		return err
+	}
+	binaryPath, err := getElectronBinaryPath(dest)
+	if err != nil {
+		return err
+	}
+
+	// put the backup back together next to app.asar first, only a complete
+	// and checked file goes in its place
+
+	tmpPath, err := restoreToTemp(src, appAsarPath)
+	if err != nil {
+		return fmt.Errorf("backup %s is not usable: %w", src, err)
+	}
+	defer os.Remove(tmpPath)
+
+	tempDir, err := createTempDir()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	// the fuse snapshot taken first after the backup holds the fuses as they
+	// were with it. one we didn't make has none, the fuses stay as they are.
+	// looked up now, the backup below may prune src
+	var original *fuseSnapshotFile
+	for _, b := range GetBackupList() {
+		if b.Filepath == src {
+			original = originalFuses(binaryPath, b)
+		}
+	}
+
+	// keep the current file around so the restore can be undone from the same
+	// list, unless it's patched (backupAppAsar skips those)
+
+	err = backupAppAsar(appAsarPath, nil)
+	if err != nil {
+		return fmt.Errorf("failed to back up current app.asar: %w", err)
+	}
+
+	p := newProgress(nil)
+	j := &journal{}
+	err = runMutating(context.Background(), p, j, mutation{
+		targetPath:  dest,
+		appAsarPath: appAsarPath,
+		newAsarPath: tmpPath,
+		tempDir:     tempDir,
+		fuses: func(j *journal, integrityErr error) error {
+			// if the integrity record couldn't be written it was never
+			// touched, which is fine for a stock asar
+			if integrityErr != nil {
+				p.log("Warning: %s", integrityErr.Error())
+			}
+			if original == nil {
+				p.log("No fuse snapshot for this backup, leaving the fuses as they are")
+				return nil
+			}
+
+			current, err := fuses.Capture(binaryPath)
+			if err != nil {
+				return fmt.Errorf("failed to read electron fuses: %w", err)
+			}
+			if err := saveFuseSnapshot(current); err != nil {
+				p.log("Warning: failed to save fuse backup: %s", err.Error())
+			}
+			j.record("electron fuses", current.Restore)
+			if err := original.Snapshot.Restore(); err != nil {
+				return fmt.Errorf("failed to restore electron fuses: %w", err)
+			}
+			p.log("Restored the fuses from %s", original.Path)
+			return nil
+		},
+	})
+	if err != nil {
+		if rbErr := j.rollback(p); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("rollback failed, Slack may need a reinstall: %w", rbErr))
+		}
+		p.log("Rolled back, Slack was left as it was.")
+		return err
+	}
+	p.log("Restored %s to %s", src, appAsarPath)
 	return nil
 }
 
-func GetBackupList() []Backup {
-	var home_dir, err = os.UserHomeDir()
+// restoreToTemp streams the backup into a temp file in the folder of
+// appAsarPath, checking its hash on the way and that it looks like Slack
+func restoreToTemp(src, appAsarPath string) (string, error) {
+	meta, err := readBackupMeta(src)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("broken metadata: %w", err)
+	}
+
+	r, err := openBackup(src)
 	if err != nil {
-		return []Backup{}
+		return "", err
 	}
-	var backup_base_path = home_dir + "/.snail/backups/"
-	var backups []Backup
+	defer r.Close()
 
-	files, err := os.ReadDir(backup_base_path)
+	tmp, err := os.CreateTemp(filepath.Dir(appAsarPath), ".app.asar-restore-*")
 	if err != nil {
-		return []Backup{}
+		return "", err
 	}
+	tmpPath := tmp.Name()
 
-	for _, file := range files {
-		info, err := file.Info()
-		if err != nil {
-			continue
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && meta != nil {
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != meta.SHA256 {
+			err = fmt.Errorf("sha256 is %s, it was %s when backed up", sum, meta.SHA256)
 		}
-		backups = append(backups, Backup{
-			Filepath: backup_base_path + file.Name(),
-			Time:     info.ModTime(),
-		})
 	}
-	return backups
+	if err == nil {
+		// make sure we aren't about to put garbage in place of slack
+		err = verifyBackup(tmpPath)
+	}
+	if info, serr := os.Stat(appAsarPath); err == nil && serr == nil {
+		err = os.Chmod(tmpPath, info.Mode())
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return tmpPath, nil
+}
+
+// verifyBackup checks that the file is an asar archive holding Slack's entry point
+func verifyBackup(path string) error {
+	archive, err := utils.OpenAsar(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	data, err := archive.ReadFile("package.json")
+	if err != nil {
+		return err
+	}
+
+	var pkg struct {
+		Name string `json:"name"`
+		Main string `json:"main"`
+	}
+	err = json.Unmarshal(data, &pkg)
+	if err != nil {
+		return fmt.Errorf("invalid package.json: %w", err)
+	}
+
+	// electron falls back to index.js when main is missing
+	entry := pkg.Main
+	if entry == "" {
+		entry = "index.js"
+	}
+
+	e := archive.Find(entry)
+	if e != nil && e.IsDir {
+		e = e.Find("index.js")
+	}
+	if e == nil || e.IsDir {
+		return fmt.Errorf("entry point %s not found", entry)
+	}
+	return nil
 }
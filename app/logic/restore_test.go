@@ -0,0 +1,71 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"snail-installer/fuses"
+	"testing"
+)
+
+// slackWithAsar is fakeSlack with a stock app.asar where linux keeps it
+func slackWithAsar(t *testing.T) (appPath, binaryPath, asarPath string) {
+	t.Helper()
+	appPath, binaryPath = fakeSlack(t)
+	asarPath = filepath.Join(appPath, "resources", "app.asar")
+	if err := os.MkdirAll(filepath.Dir(asarPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(packApp(t, stockSlack), asarPath); err != nil {
+		t.Fatal(err)
+	}
+	return appPath, binaryPath, asarPath
+}
+
+func integrityFuse(t *testing.T, binaryPath string) fuses.State {
+	t.Helper()
+	bin, err := fuses.Read(binaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := bin.Wires[0].State(fuses.EnableEmbeddedAsarIntegrityValidation)
+	return s
+}
+
+func TestRestoreBackupPutsFusesBack(t *testing.T) {
+	for _, before := range []fuses.State{fuses.Enabled, fuses.Disabled} {
+		t.Run(before.String(), func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			appPath, binaryPath, asarPath := slackWithAsar(t)
+			if before == fuses.Disabled {
+				// someone else turned it off before we ever came along
+				if _, err := fuses.Write(binaryPath, map[fuses.Fuse]fuses.State{fuses.EnableEmbeddedAsarIntegrityValidation: before}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// what an install that couldn't write the integrity record does
+			if err := backupAppAsar(asarPath, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writeElectronFuse(appPath, fuses.EnableEmbeddedAsarIntegrityValidation, false); err != nil {
+				t.Fatal(err)
+			}
+			patchAsarFile(t, asarPath)
+
+			backups := GetBackupList()
+			if len(backups) != 1 {
+				t.Fatalf("got %d backups, want 1", len(backups))
+			}
+			if err := RestoreBackup(backups[0].Filepath, appPath); err != nil {
+				t.Fatal(err)
+			}
+
+			if v, _ := asarPatchVersion(asarPath); v >= 0 {
+				t.Errorf("app.asar still has snail patch v%d", v)
+			}
+			if got := integrityFuse(t, binaryPath); got != before {
+				t.Errorf("fuse is %s after restoring, it was %s when backed up", got, before)
+			}
+		})
+	}
+}
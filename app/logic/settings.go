@@ -8,6 +8,16 @@ import (
 
 type Settings struct {
 	ServerURL string
+
+	// extra PEM files to trust besides the system CAs, for proxies that
+	// intercept TLS
+	CABundles []string
+	// sent with every download, defaults to snail-installer
+	UserAgent string
+
+	// how many app.asar backups to keep, 0 means 5. the newest untouched
+	// backup of every Slack version is kept on top of these
+	KeepBackups int
 }
 
 var AppSettings Settings
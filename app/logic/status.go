@@ -0,0 +1,285 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"snail-installer/fuses"
+	"strings"
+	"time"
+)
+
+// values of StatusReport.State
+const (
+	StateNotInstalled = "not installed"
+	StateInstalled    = "installed"
+	StateOutdated     = "outdated" // an older patch than this installer's
+)
+
+// Fix names something Status found that ApplyFix can repair
+type Fix string
+
+const (
+	FixInstall  Fix = "install"  // patch slack (again)
+	FixLoader   Fix = "loader"   // download main.js and preload.js again
+	FixCodeSign Fix = "codesign" // ad-hoc sign the app again (macOS)
+)
+
+type Problem struct {
+	Message string `json:"message"`
+	Fix     Fix    `json:"fix,omitempty"` // empty when there's nothing we can do about it
+}
+
+// LoaderFile is one of the files in ~/.snail/internal
+type LoaderFile struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Exists  bool   `json:"exists"`
+	Version string `json:"version,omitempty"` // loader version it was installed from, if we know
+}
+
+type StatusReport struct {
+	SlackPath    string `json:"slackPath"`
+	SlackVersion string `json:"slackVersion,omitempty"`
+	AsarPath     string `json:"asarPath"`
+	Installed    bool   `json:"installed"`
+	State        string `json:"state"`
+	PatchVersion int    `json:"patchVersion"` // -1 when not installed
+	InjectMarker bool   `json:"injectMarker"` // legacy patches have none
+	// how slack gets patched (or would be), see strategy.go
+	PatchStrategy string            `json:"patchStrategy,omitempty"`
+	Fuses         map[string]string `json:"fuses,omitempty"`
+
+	// macOS only, nil elsewhere
+	CodeSignatureValid *bool `json:"codeSignatureValid,omitempty"`
+
+	Loader        []LoaderFile `json:"loader"`
+	LoaderVersion string       `json:"loaderVersion,omitempty"` // from ~/.snail/config.json
+	ServerVersion string       `json:"serverVersion,omitempty"` // from /info.json, empty when offline
+
+	PluginsEnabled int `json:"pluginsEnabled"`
+	ThemesEnabled  int `json:"themesEnabled"`
+
+	Problems []Problem `json:"problems"`
+}
+
+// Summary is the state in words, like "installed v1"
+func (r *StatusReport) Summary() string {
+	switch r.State {
+	case StateInstalled:
+		return fmt.Sprintf("installed v%d", r.PatchVersion)
+	case StateOutdated:
+		return fmt.Sprintf("installed v%d, outdated (v%d available)", r.PatchVersion, PatchVersion)
+	default:
+		return r.State
+	}
+}
+
+// Healthy is true when Status found nothing wrong
+func (r *StatusReport) Healthy() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *StatusReport) problem(fix Fix, format string, args ...any) {
+	r.Problems = append(r.Problems, Problem{Message: fmt.Sprintf(format, args...), Fix: fix})
+}
+
+// Status looks at a Slack install and ~/.snail without changing anything
+func Status(path string) (*StatusReport, error) {
+	if !verifySlackInstall(path) {
+		return nil, fmt.Errorf("invalid Slack installation path: %s", path)
+	}
+
+	appAsarPath, err := getAppAsarPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &StatusReport{
+		SlackPath:    path,
+		SlackVersion: readSlackVersion(appAsarPath),
+		AsarPath:     appAsarPath,
+		Loader:       []LoaderFile{},
+		Problems:     []Problem{},
+	}
+
+	report.PatchVersion, err = asarPatchVersion(appAsarPath)
+	if err != nil {
+		return nil, err
+	}
+	report.Installed = report.PatchVersion >= 0
+	report.PatchStrategy = asarPatchStrategy(appAsarPath)
+	report.InjectMarker = report.PatchVersion > legacyPatchVersion
+	switch {
+	case !report.Installed:
+		report.State = StateNotInstalled
+		report.problem(FixInstall, "snail is not installed in this Slack")
+	case report.PatchVersion < PatchVersion:
+		report.State = StateOutdated
+		report.problem(FixInstall, "Slack has snail patch v%d, this installer has v%d", report.PatchVersion, PatchVersion)
+	default:
+		report.State = StateInstalled
+	}
+
+	bin, err := InspectFuses(path)
+	if err != nil {
+		println("Warning: could not read electron fuses:", err.Error())
+	} else if len(bin.Wires) > 0 {
+		report.Fuses = map[string]string{}
+		for i, state := range bin.Wires[0].States {
+			report.Fuses[fuses.Fuse(i).String()] = state.String()
+		}
+	}
+
+	if runtime.GOOS == "darwin" {
+		valid := codeSignatureValid(path)
+		report.CodeSignatureValid = &valid
+		if !valid {
+			report.problem(FixCodeSign, "the code signature of Slack is broken, macOS won't start it")
+		}
+	}
+
+	checkRuntime(report)
+	return report, nil
+}
+
+// checkRuntime fills in what ~/.snail has: the loader, its config and
+// whether the server has a newer loader
+func checkRuntime(report *StatusReport) {
+	dir, err := snailDir()
+	if err != nil {
+		report.problem("", "%s", err.Error())
+		return
+	}
+
+	var config struct {
+		LoaderVersion  string   `json:"loaderVersion"`
+		PluginsEnabled []string `json:"pluginsEnabled"`
+		ThemesEnabled  []string `json:"themesEnabled"`
+	}
+	configPath := filepath.Join(dir, "config.json")
+	data, err := os.ReadFile(configPath)
+	switch {
+	case os.IsNotExist(err):
+		report.problem(FixLoader, "%s is missing", configPath)
+	case err != nil:
+		report.problem("", "could not read %s: %s", configPath, err.Error())
+	default:
+		if err := json.Unmarshal(data, &config); err != nil {
+			report.problem(FixLoader, "%s is not valid JSON: %s", configPath, err.Error())
+		}
+	}
+	report.LoaderVersion = config.LoaderVersion
+	report.PluginsEnabled = len(config.PluginsEnabled)
+	report.ThemesEnabled = len(config.ThemesEnabled)
+
+	// the newest install history entry says which loader a file came from
+	history, _ := InstallHistory()
+	for _, name := range loaderFiles {
+		file := LoaderFile{Name: name, Path: filepath.Join(dir, "internal", name)}
+		_, err := os.Stat(file.Path)
+		file.Exists = err == nil
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].Name == name {
+				file.Version = history[i].Loader
+				break
+			}
+		}
+		if !file.Exists {
+			report.problem(FixLoader, "%s is missing, Slack starts without snail", file.Path)
+		}
+		report.Loader = append(report.Loader, file)
+	}
+
+	report.ServerVersion, err = fetchServerVersion()
+	if err != nil {
+		report.problem("", "could not ask the server for the latest loader: %s", err.Error())
+		return
+	}
+	if report.ServerVersion != "unknown" && report.LoaderVersion != "" && report.LoaderVersion != report.ServerVersion {
+		report.problem(FixLoader, "the loader is %s, the server has %s", report.LoaderVersion, report.ServerVersion)
+	}
+}
+
+// fetchServerVersion asks /info.json for the latest loader version. status
+// shouldn't hang when offline, so it gets one quick try
+func fetchServerVersion() (string, error) {
+	d, err := newDownloader()
+	if err != nil {
+		return "", err
+	}
+	d.attempts = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := d.Get(ctx, AppSettings.ServerURL+"info.json", maxManifestSize)
+	if err != nil {
+		return "", err
+	}
+
+	var info struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return "", fmt.Errorf("failed to parse info.json: %w", err)
+	}
+	return strings.TrimSpace(info.Version), nil
+}
+
+func codeSignatureValid(appPath string) bool {
+	return exec.Command("/usr/bin/codesign", "--verify", "--deep", "--strict", appPath).Run() == nil
+}
+
+// ApplyFix repairs one of the problems Status reports
+func ApplyFix(path string, fix Fix) error {
+	switch fix {
+	case FixInstall:
+		return InstallSomething(InstallOptions{TargetPath: path})
+	case FixLoader:
+		return refreshLoader(context.Background())
+	case FixCodeSign:
+		if runtime.GOOS != "darwin" {
+			return errors.New("code signing is only a thing on macOS")
+		}
+		return codeSignMacOS(path)
+	default:
+		return fmt.Errorf("don't know how to fix %q", fix)
+	}
+}
+
+// refreshLoader puts the server's loader and config into ~/.snail without
+// touching slack
+func refreshLoader(ctx context.Context) error {
+	tempDir, err := createTempDir()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	p := newProgress(nil)
+	manifest, err := fetchManifest(ctx, AppSettings.ServerURL)
+	if err != nil {
+		return err
+	}
+	p.log("Verified manifest for loader %s", manifest.Version)
+
+	// a loader that's half old and half new is worse than the old one
+	j := &journal{}
+	installed, err := provisionRuntime(ctx, p, j, manifest, nil, tempDir)
+	if err != nil {
+		return errors.Join(err, j.rollback(p))
+	}
+	for i := range installed {
+		installed[i].InstalledAt = time.Now()
+	}
+	if err := recordInstalled(installed...); err != nil {
+		p.log("Warning: failed to record installed assets: %s", err.Error())
+	}
+	return nil
+}
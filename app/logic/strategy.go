@@ -0,0 +1,598 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"snail-installer/utils"
+	"strings"
+)
+
+// AppFiles is slack's app, either unpacked into a folder or still in app.asar.
+// names are slash separated and relative to the root of the app
+type AppFiles interface {
+	ReadFile(name string) ([]byte, error)
+	// Exists is true for regular files
+	Exists(name string) bool
+	// Unpacked is true for files that live in app.asar.unpacked. they are
+	// there because something needs them on disk, an edit would pull them
+	// into app.asar (see utils.PatchAsar) so we leave them alone
+	Unpacked(name string) bool
+}
+
+// AppDir is an app we can change
+type AppDir interface {
+	AppFiles
+	WriteFile(name string, data []byte) error
+	Remove(name string) error
+}
+
+// AppEntry is what electron runs, from the main field of package.json
+type AppEntry struct {
+	Main   string `json:"main"`   // as written in package.json
+	Path   string `json:"path"`   // the file it resolves to
+	Module bool   `json:"module"` // an ES module, can't use require
+}
+
+// PatchStrategy is one way of making slack load inject.js
+type PatchStrategy interface {
+	Name() string
+	// Detect says whether this strategy is the one for an app
+	Detect(app AppFiles, entry AppEntry) bool
+	// Apply writes inject.js (and whatever else it needs) and hooks it up,
+	// replacing an older patch. it returns the version it replaced, -1 if none
+	Apply(app AppDir, entry AppEntry, injectJs []byte) (int, error)
+	// Verify returns the version of the snail patch in the app, -1 if none
+	Verify(app AppFiles, entry AppEntry) (int, error)
+	// Revert takes the patch out again and returns its version, -1 if there was none
+	Revert(app AppDir, entry AppEntry) (int, error)
+}
+
+// first match wins. shim goes first, an app it patched has the shim as its
+// entry, which every other strategy would happily patch again
+var patchStrategies = []PatchStrategy{
+	shimStrategy{},
+	inlineStrategy{},
+	esmStrategy{},
+	requireStrategy{},
+}
+
+// where installers before the strategies put the patch, whatever main says
+var legacyEntrypoints = []string{"index.js", "dist/main.bundle.cjs"}
+
+// choosePatchStrategy reads package.json and picks the strategy for its entry
+func choosePatchStrategy(app AppFiles) (PatchStrategy, AppEntry, error) {
+	entry, err := resolveEntry(app)
+	if err != nil {
+		return nil, AppEntry{}, err
+	}
+	for _, s := range patchStrategies {
+		if s.Detect(app, entry) {
+			return s, entry, nil
+		}
+	}
+	return nil, entry, fmt.Errorf("don't know how to patch %s", entry.Path)
+}
+
+// patchApp makes an app load injectJs. it returns the strategy it
+// used and the version of the patch it replaced, -1 if there was none
+func patchApp(app AppDir, injectJs []byte) (PatchStrategy, int, error) {
+	strategy, entry, err := choosePatchStrategy(app)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	// a slack that moved its entry may still have an old patch somewhere else,
+	// that one goes before its inject.js gets replaced
+	version, err := stripLegacy(app, entry)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	replaced, err := strategy.Apply(app, entry, injectJs)
+	if err != nil {
+		return nil, -1, err
+	}
+	if replaced >= 0 {
+		version = replaced
+	}
+	return strategy, version, nil
+}
+
+// unpatchApp takes the patch out of an app and returns its version,
+// -1 if there was none
+func unpatchApp(app AppDir) (int, error) {
+	strategy, entry, err := choosePatchStrategy(app)
+	if err != nil {
+		return -1, err
+	}
+	legacy, err := stripLegacy(app, entry)
+	if err != nil {
+		return -1, err
+	}
+	version, err := strategy.Revert(app, entry)
+	if err != nil {
+		return -1, err
+	}
+	if version < 0 {
+		version = legacy
+	}
+	return version, nil
+}
+
+// appPatchVersion is the version of the patch in an app, -1 means untouched
+func appPatchVersion(app AppFiles) (int, error) {
+	strategy, entry, err := choosePatchStrategy(app)
+	if err != nil {
+		return -1, err
+	}
+	version, err := strategy.Verify(app, entry)
+	if err != nil || version >= 0 {
+		return version, err
+	}
+	for _, name := range legacyEntrypoints {
+		if name == entry.Path || !app.Exists(name) {
+			continue
+		}
+		if version, err := fileVersion(app, name); err != nil || version >= 0 {
+			return version, err
+		}
+	}
+	return -1, nil
+}
+
+// stripLegacy takes patches out of the old entrypoints that aren't entry
+func stripLegacy(app AppDir, entry AppEntry) (int, error) {
+	version := -1
+	for _, name := range legacyEntrypoints {
+		if name == entry.Path || !app.Exists(name) || app.Unpacked(name) {
+			continue
+		}
+		v, err := stripFile(app, name)
+		if err != nil {
+			return -1, err
+		}
+		if v >= 0 && version < 0 {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+type packageJSON struct {
+	Main string `json:"main"`
+	Type string `json:"type"`
+}
+
+func readPackageJSON(app AppFiles) (packageJSON, error) {
+	var pkg packageJSON
+	data, err := app.ReadFile("package.json")
+	if err != nil {
+		return pkg, fmt.Errorf("failed to read package.json: %w", err)
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return pkg, fmt.Errorf("invalid package.json: %w", err)
+	}
+	return pkg, nil
+}
+
+// resolveEntry finds the file main points at the way node would
+func resolveEntry(app AppFiles) (AppEntry, error) {
+	pkg, err := readPackageJSON(app)
+	if err != nil {
+		return AppEntry{}, err
+	}
+
+	main := pkg.Main
+	if main == "" {
+		// electron falls back to index.js when main is missing
+		main = "index.js"
+	}
+	clean := path.Clean(strings.TrimPrefix(main, "./"))
+
+	for _, candidate := range []string{clean, clean + ".js", clean + "/index.js"} {
+		if !app.Exists(candidate) {
+			continue
+		}
+		entry := AppEntry{Main: pkg.Main, Path: candidate}
+		switch path.Ext(candidate) {
+		case ".mjs":
+			entry.Module = true
+		case ".js":
+			entry.Module = pkg.Type == "module"
+		}
+		return entry, nil
+	}
+	return AppEntry{}, fmt.Errorf("entry point %s from package.json not found", main)
+}
+
+// relImport is how entry refers to name, "./inject.js" or "../inject.js"
+func relImport(entry, name string) string {
+	rel, err := filepath.Rel(path.Dir(entry), name)
+	if err != nil {
+		return "./" + name
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, ".") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+// prependPatch puts code at the top of file in markers, taking any older
+// patch off first. oldInjectJs is what an older install inlined
+func prependPatch(app AppDir, file, code string, oldInjectJs []byte) (int, error) {
+	data, err := app.ReadFile(file)
+	if err != nil {
+		return -1, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	data, version := stripPatch(data, oldInjectJs)
+	if err := app.WriteFile(file, append(markPatch(code), data...)); err != nil {
+		return -1, fmt.Errorf("failed to write modified %s: %w", file, err)
+	}
+	return version, nil
+}
+
+// stripFile takes the patch off the top of file
+func stripFile(app AppDir, file string) (int, error) {
+	data, err := app.ReadFile(file)
+	if err != nil {
+		return -1, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	injectJs, _ := app.ReadFile("inject.js")
+	data, version := stripPatch(data, injectJs)
+	if version < 0 {
+		return -1, nil
+	}
+	if err := app.WriteFile(file, data); err != nil {
+		return -1, fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return version, nil
+}
+
+func fileVersion(app AppFiles, file string) (int, error) {
+	data, err := app.ReadFile(file)
+	if err != nil {
+		return -1, fmt.Errorf("failed to read %s from app.asar: %w", file, err)
+	}
+	injectJs, _ := app.ReadFile("inject.js")
+	_, version := stripPatch(data, injectJs)
+	return version, nil
+}
+
+// writeInject copies inject.js into the app and returns the one it replaced
+func writeInject(app AppDir, name string, injectJs []byte) ([]byte, error) {
+	old, _ := app.ReadFile(name)
+	if err := app.WriteFile(name, injectJs); err != nil {
+		return nil, fmt.Errorf("failed to add %s to the app: %w", name, err)
+	}
+	return old, nil
+}
+
+func removeIfExists(app AppDir, name string) error {
+	if !app.Exists(name) {
+		return nil
+	}
+	return app.Remove(name)
+}
+
+// requireStrategy: plain commonjs entries get a require at the top
+type requireStrategy struct{}
+
+func (requireStrategy) Name() string { return "require" }
+
+func (requireStrategy) Detect(app AppFiles, entry AppEntry) bool {
+	return !entry.Module
+}
+
+func (requireStrategy) Apply(app AppDir, entry AppEntry, injectJs []byte) (int, error) {
+	old, err := writeInject(app, "inject.js", injectJs)
+	if err != nil {
+		return -1, err
+	}
+	return prependPatch(app, entry.Path, fmt.Sprintf("require('%s');", relImport(entry.Path, "inject.js")), old)
+}
+
+func (requireStrategy) Verify(app AppFiles, entry AppEntry) (int, error) {
+	return fileVersion(app, entry.Path)
+}
+
+func (requireStrategy) Revert(app AppDir, entry AppEntry) (int, error) {
+	version, err := stripFile(app, entry.Path)
+	if err != nil {
+		return -1, err
+	}
+	return version, removeIfExists(app, "inject.js")
+}
+
+// inlineStrategy: webpack bundles like dist/main.bundle.cjs get all of
+// inject.js pasted at the top
+type inlineStrategy struct{}
+
+func (inlineStrategy) Name() string { return "inline" }
+
+func (inlineStrategy) Detect(app AppFiles, entry AppEntry) bool {
+	base := path.Base(entry.Path)
+	return !entry.Module && (strings.HasSuffix(base, ".bundle.cjs") || strings.HasSuffix(base, ".bundle.js"))
+}
+
+func (inlineStrategy) Apply(app AppDir, entry AppEntry, injectJs []byte) (int, error) {
+	// the copy next to it is how a later install finds what was inlined
+	old, err := writeInject(app, "inject.js", injectJs)
+	if err != nil {
+		return -1, err
+	}
+	return prependPatch(app, entry.Path, string(injectJs), old)
+}
+
+func (inlineStrategy) Verify(app AppFiles, entry AppEntry) (int, error) {
+	return fileVersion(app, entry.Path)
+}
+
+func (inlineStrategy) Revert(app AppDir, entry AppEntry) (int, error) {
+	version, err := stripFile(app, entry.Path)
+	if err != nil {
+		return -1, err
+	}
+	return version, removeIfExists(app, "inject.js")
+}
+
+// esmStrategy: ES modules can't require, they import a .cjs copy of
+// inject.js (a .js would count as an ES module in a "type": "module" app)
+type esmStrategy struct{}
+
+const esmInjectName = "inject.cjs"
+
+func (esmStrategy) Name() string { return "esm" }
+
+func (esmStrategy) Detect(app AppFiles, entry AppEntry) bool {
+	return entry.Module
+}
+
+func (esmStrategy) Apply(app AppDir, entry AppEntry, injectJs []byte) (int, error) {
+	if _, err := writeInject(app, esmInjectName, injectJs); err != nil {
+		return -1, err
+	}
+	// imports run in order before the rest of the module, so this one goes first
+	return prependPatch(app, entry.Path, fmt.Sprintf("import '%s';", relImport(entry.Path, esmInjectName)), nil)
+}
+
+func (esmStrategy) Verify(app AppFiles, entry AppEntry) (int, error) {
+	return fileVersion(app, entry.Path)
+}
+
+func (esmStrategy) Revert(app AppDir, entry AppEntry) (int, error) {
+	version, err := stripFile(app, entry.Path)
+	if err != nil {
+		return -1, err
+	}
+	return version, removeIfExists(app, esmInjectName)
+}
+
+// shimStrategy: when the entry can't be changed (it lives in
+// app.asar.unpacked) main is pointed at a shim that loads inject.js and then
+// the real entry
+type shimStrategy struct{}
+
+const (
+	shimName      = "snail-shim.js"
+	shimESMName   = "snail-shim.mjs"
+	shimEntryLine = "// snail-original-entry: "
+)
+
+var (
+	packageMainRe      = regexp.MustCompile(`("main"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	packageMainFieldRe = regexp.MustCompile(`\s*"main"\s*:\s*"(?:[^"\\]|\\.)*"\s*,?`)
+)
+
+func isShim(main string) bool {
+	main = strings.TrimPrefix(main, "./")
+	return main == shimName || main == shimESMName
+}
+
+func (shimStrategy) Name() string { return "shim" }
+
+func (shimStrategy) Detect(app AppFiles, entry AppEntry) bool {
+	return isShim(entry.Main) || app.Unpacked(entry.Path)
+}
+
+func (shimStrategy) Apply(app AppDir, entry AppEntry, injectJs []byte) (int, error) {
+	version := -1
+	if isShim(entry.Main) {
+		// patched before, carry on with the entry the old shim remembered
+		var err error
+		version, entry, err = readShim(app, entry)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	// Revert puts main back from this
+	original, _ := json.Marshal(entry)
+	shim := shimName
+	code := fmt.Sprintf("%s%s\nrequire('./inject.js');\nmodule.exports = require('./%s');", shimEntryLine, original, entry.Path)
+	injectName := "inject.js"
+	if entry.Module {
+		shim = shimESMName
+		injectName = esmInjectName
+		code = fmt.Sprintf("%s%s\nimport './%s';\nimport './%s';", shimEntryLine, original, esmInjectName, entry.Path)
+	}
+
+	if _, err := writeInject(app, injectName, injectJs); err != nil {
+		return -1, err
+	}
+	if err := app.WriteFile(shim, markPatch(code)); err != nil {
+		return -1, fmt.Errorf("failed to write %s: %w", shim, err)
+	}
+	if err := setPackageMain(app, shim); err != nil {
+		return -1, err
+	}
+	return version, nil
+}
+
+func (shimStrategy) Verify(app AppFiles, entry AppEntry) (int, error) {
+	if !isShim(entry.Main) {
+		return -1, nil
+	}
+	return fileVersion(app, entry.Path)
+}
+
+func (shimStrategy) Revert(app AppDir, entry AppEntry) (int, error) {
+	if !isShim(entry.Main) {
+		return -1, nil
+	}
+	version, original, err := readShim(app, entry)
+	if err != nil {
+		return -1, err
+	}
+	if err := setPackageMain(app, original.Main); err != nil {
+		return -1, err
+	}
+	for _, name := range []string{entry.Path, "inject.js", esmInjectName} {
+		if err := removeIfExists(app, name); err != nil {
+			return -1, err
+		}
+	}
+	return version, nil
+}
+
+// readShim returns the patch version of a shim and the entry it loads
+func readShim(app AppFiles, shim AppEntry) (int, AppEntry, error) {
+	data, err := app.ReadFile(shim.Path)
+	if err != nil {
+		return -1, AppEntry{}, fmt.Errorf("failed to read %s: %w", shim.Path, err)
+	}
+	version, _, ok := cutMarkedPatch(data)
+	if !ok {
+		return -1, AppEntry{}, fmt.Errorf("%s has no snail patch", shim.Path)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, shimEntryLine); ok {
+			var original AppEntry
+			if err := json.Unmarshal([]byte(rest), &original); err != nil || original.Path == "" {
+				break
+			}
+			return version, original, nil
+		}
+	}
+	return -1, AppEntry{}, fmt.Errorf("%s doesn't say what the original entry was", shim.Path)
+}
+
+// setPackageMain changes main in package.json without touching the rest of
+// it, an empty main takes the field out
+func setPackageMain(app AppDir, main string) error {
+	data, err := app.ReadFile("package.json")
+	if err != nil {
+		return fmt.Errorf("failed to read package.json: %w", err)
+	}
+
+	encoded, _ := json.Marshal(main)
+	s := string(data)
+	switch {
+	case main == "":
+		if loc := packageMainFieldRe.FindStringIndex(s); loc != nil {
+			head, rest := s[:loc[0]], s[loc[1]:]
+			if lastField(rest) {
+				head = strings.TrimSuffix(strings.TrimRight(head, " \t\r\n"), ",")
+			}
+			s = head + rest
+		}
+	case packageMainRe.MatchString(s):
+		loc := packageMainRe.FindStringSubmatchIndex(s)
+		s = s[:loc[3]] + string(encoded) + s[loc[1]:]
+	default:
+		i := strings.Index(s, "{")
+		if i < 0 {
+			return errors.New("invalid package.json")
+		}
+		field := `"main": ` + string(encoded)
+		if !lastField(s[i+1:]) {
+			field += ","
+		}
+		s = s[:i+1] + field + s[i+1:]
+	}
+
+	var check packageJSON
+	if err := json.Unmarshal([]byte(s), &check); err != nil || check.Main != main {
+		return fmt.Errorf("failed to point package.json main at %s", main)
+	}
+	return app.WriteFile("package.json", []byte(s))
+}
+
+// lastField is true when nothing but the closing brace comes after
+func lastField(rest string) bool {
+	return strings.HasPrefix(strings.TrimSpace(rest), "}")
+}
+
+// asarApp looks inside app.asar without unpacking it
+type asarApp struct {
+	archive *utils.AsarArchive
+}
+
+func (a asarApp) ReadFile(name string) ([]byte, error) {
+	if e := a.archive.Find(name); e != nil && e.Unpacked {
+		return os.ReadFile(filepath.Join(a.archive.Path+".unpacked", filepath.FromSlash(name)))
+	}
+	return a.archive.ReadFile(name)
+}
+
+func (a asarApp) Exists(name string) bool {
+	e := a.archive.Find(name)
+	return e != nil && !e.IsDir && e.Link == ""
+}
+
+func (a asarApp) Unpacked(name string) bool {
+	e := a.archive.Find(name)
+	return e != nil && e.Unpacked
+}
+
+// asarEdits is app.asar with changes on top, utils.PatchAsar writes them out
+type asarEdits struct {
+	asarApp
+	files map[string][]byte // nil for removed files
+}
+
+func newAsarEdits(archive *utils.AsarArchive) *asarEdits {
+	return &asarEdits{asarApp: asarApp{archive}, files: map[string][]byte{}}
+}
+
+func (e *asarEdits) ReadFile(name string) ([]byte, error) {
+	if data, ok := e.files[name]; ok {
+		if data == nil {
+			return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+		}
+		return data, nil
+	}
+	return e.asarApp.ReadFile(name)
+}
+
+func (e *asarEdits) Exists(name string) bool {
+	if data, ok := e.files[name]; ok {
+		return data != nil
+	}
+	return e.asarApp.Exists(name)
+}
+
+func (e *asarEdits) WriteFile(name string, data []byte) error {
+	e.files[name] = append([]byte{}, data...)
+	return nil
+}
+
+func (e *asarEdits) Remove(name string) error {
+	e.files[name] = nil
+	return nil
+}
+
+// edits is the changes as utils.PatchAsar takes them
+func (e *asarEdits) edits() map[string]func([]byte) []byte {
+	edits := map[string]func([]byte) []byte{}
+	for name, data := range e.files {
+		edits[name] = func([]byte) []byte { return data }
+	}
+	return edits
+}
@@ -0,0 +1,156 @@
+package logic
+
+import (
+	"bytes"
+	"snail-installer/utils"
+	"testing"
+)
+
+var strategyTests = []struct {
+	name     string
+	files    map[string]string
+	unpack   []string
+	strategy string
+	// where the patch ends up
+	patched string
+}{
+	{
+		name:     "require",
+		files:    stockSlack,
+		strategy: "require",
+		patched:  "index.js",
+	},
+	{
+		name: "inline",
+		files: map[string]string{
+			"package.json":         `{"name":"slack","version":"4.41.0","main":"dist/main.bundle.cjs"}`,
+			"dist/main.bundle.cjs": "console.log('slack')\n",
+		},
+		strategy: "inline",
+		patched:  "dist/main.bundle.cjs",
+	},
+	{
+		name: "esm",
+		files: map[string]string{
+			"package.json": `{"name":"slack","version":"4.41.0","type":"module","main":"dist/main.js"}`,
+			"dist/main.js": "import './boot.js';\n",
+			"dist/boot.js": "console.log('slack')\n",
+		},
+		strategy: "esm",
+		patched:  "dist/main.js",
+	},
+	{
+		name:     "shim",
+		files:    stockSlack,
+		unpack:   []string{"index.js"},
+		strategy: "shim",
+		patched:  shimName,
+	},
+	{
+		name: "shim esm",
+		files: map[string]string{
+			"package.json": `{"name":"slack","version":"4.41.0","type":"module","main":"index.js"}`,
+			"index.js":     "console.log('slack')\n",
+		},
+		unpack:   []string{"index.js"},
+		strategy: "shim",
+		patched:  shimESMName,
+	},
+	{
+		name: "shim without main",
+		files: map[string]string{
+			"package.json": `{"name":"slack","version":"4.41.0"}`,
+			"index.js":     "console.log('slack')\n",
+		},
+		unpack:   []string{"index.js"},
+		strategy: "shim",
+		patched:  shimName,
+	},
+}
+
+// patch -> patch again -> unpatch has to end with the app as it was
+func TestStrategyRoundTrip(t *testing.T) {
+	injectJs := []byte("console.log('snail')\n")
+
+	for _, tt := range strategyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			asarPath := packAppWith(t, tt.files, utils.PackOptions{Unpack: tt.unpack})
+
+			if got := asarPatchStrategy(asarPath); got != tt.strategy {
+				t.Fatalf("picked the %s strategy, want %s", got, tt.strategy)
+			}
+
+			// patch
+			editAsar(t, asarPath, func(app *asarEdits) error {
+				strategy, replaced, err := patchApp(app, injectJs)
+				if err == nil && (strategy.Name() != tt.strategy || replaced != -1) {
+					t.Errorf("patched with %s replacing v%d, want %s replacing nothing", strategy.Name(), replaced, tt.strategy)
+				}
+				return err
+			})
+			if v, err := asarPatchVersion(asarPath); err != nil || v != PatchVersion {
+				t.Fatalf("patch version is %d (%v) after patching, want %d", v, err, PatchVersion)
+			}
+			once := readAsarFile(t, asarPath, tt.patched)
+
+			// patch again, the new patch replaces the old one
+			editAsar(t, asarPath, func(app *asarEdits) error {
+				_, replaced, err := patchApp(app, injectJs)
+				if err == nil && replaced != PatchVersion {
+					t.Errorf("second patch replaced v%d, want v%d", replaced, PatchVersion)
+				}
+				return err
+			})
+			if twice := readAsarFile(t, asarPath, tt.patched); !bytes.Equal(once, twice) {
+				t.Errorf("%s changed when patching again:\n%s\nwas\n%s", tt.patched, twice, once)
+			}
+
+			// unpatch
+			editAsar(t, asarPath, func(app *asarEdits) error {
+				version, err := unpatchApp(app)
+				if err == nil && version != PatchVersion {
+					t.Errorf("unpatch removed v%d, want v%d", version, PatchVersion)
+				}
+				return err
+			})
+			if v, _ := asarPatchVersion(asarPath); v != -1 {
+				t.Errorf("patch version is %d after unpatching", v)
+			}
+
+			archive, err := utils.OpenAsar(asarPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer archive.Close()
+			app := asarApp{archive}
+			for name, want := range tt.files {
+				got, err := app.ReadFile(name)
+				if err != nil {
+					t.Errorf("%s: %s", name, err)
+				} else if string(got) != want {
+					t.Errorf("%s is\n%s\nafter unpatching, want\n%s", name, got, want)
+				}
+			}
+			for _, name := range []string{"inject.js", esmInjectName, shimName, shimESMName} {
+				if _, ok := tt.files[name]; !ok && app.Exists(name) {
+					t.Errorf("%s is still in the app after unpatching", name)
+				}
+			}
+		})
+	}
+}
+
+func readAsarFile(t *testing.T, asarPath, name string) []byte {
+	t.Helper()
+	archive, err := utils.OpenAsar(asarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	data, err := asarApp{archive}.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,165 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"snail-installer/fuses"
+	"snail-installer/utils"
+)
+
+type UninstallOptions struct {
+	TargetPath string
+	// also delete ~/.snail/internal, plugins, themes and backups
+	RemoveUserData bool
+
+	// optional, Context can cancel the uninstall until app.asar is about
+	// to be replaced
+	Context  context.Context
+	Progress ProgressFunc
+}
+
+// Uninstall takes snail out of Slack and turns asar integrity validation
+// back on. it goes through the same journal as an install, if any of it
+// fails Slack is rolled back to how it was, snail and all
+func Uninstall(opts UninstallOptions) error {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p := newProgress(opts.Progress)
+
+	var appAsarPath string
+	err := p.run(ctx, StepVerify, func() error {
+		if !verifySlackInstall(opts.TargetPath) {
+			p.log("Invalid Slack installation path: %s", opts.TargetPath)
+			return errors.New("invalid Slack installation path")
+		}
+
+		var err error
+		appAsarPath, err = getAppAsarPath(opts.TargetPath)
+		if err != nil {
+			return err
+		}
+		p.log("Using app.asar path: %s", appAsarPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tempDir, err := createTempDir()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	p.log("Created temporary directory at: %s", tempDir)
+
+	var edits map[string]func([]byte) []byte
+	err = p.run(ctx, StepUnpatch, func() error {
+		var err error
+		edits, err = removeInjectCode(p, appAsarPath)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// write the unpatched asar next to the original first
+
+	newAsarPath := filepath.Join(tempDir, "app-new.asar")
+	err = p.run(ctx, StepRepack, func() error {
+		if err := utils.PatchAsar(appAsarPath, newAsarPath, edits); err != nil {
+			return fmt.Errorf("failed to repack asar: %w", err)
+		}
+		p.log("Repacked the unpatched app.asar to: %s", newAsarPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// from here on slack changes, stopping halfway would be worse than finishing
+	j := &journal{}
+	err = runMutating(context.Background(), p, j, mutation{
+		targetPath:  opts.TargetPath,
+		appAsarPath: appAsarPath,
+		newAsarPath: newAsarPath,
+		tempDir:     tempDir,
+		fuses: func(j *journal, integrityErr error) error {
+			// the repacked header differs from the stock one, the validation
+			// fuse can only go back on with an integrity record to match.
+			// without it the way out isn't clean, so none of it happens
+			if integrityErr != nil {
+				return fmt.Errorf("can't turn asar integrity validation back on, restore a backup instead: %w", integrityErr)
+			}
+
+			snapshot, err := writeElectronFuse(opts.TargetPath, fuses.EnableEmbeddedAsarIntegrityValidation, true)
+			if snapshot != nil {
+				j.record("electron fuses", snapshot.Restore)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to restore electron fuses: %w", err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		if rbErr := j.rollback(p); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("rollback failed, Slack may need a reinstall: %w", rbErr))
+		}
+		p.log("Rolled back, Slack was left as it was.")
+		return err
+	}
+	p.log("Removed snail from %s", opts.TargetPath)
+
+	if opts.RemoveUserData {
+		err = removeUserData(p)
+		if err != nil {
+			return fmt.Errorf("slack was restored but cleaning ~/.snail failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// removeInjectCode works out what undoes InstallSomething, as changes for
+// utils.PatchAsar
+func removeInjectCode(p *progress, appAsarPath string) (map[string]func([]byte) []byte, error) {
+	archive, err := utils.OpenAsar(appAsarPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", appAsarPath, err)
+	}
+	defer archive.Close()
+
+	app := newAsarEdits(archive)
+	version, err := unpatchApp(app)
+	if err != nil {
+		return nil, err
+	}
+	if version < 0 {
+		return nil, fmt.Errorf("snail is not installed: no snail patch found")
+	}
+	p.log("Removed snail patch v%d", version)
+	return app.edits(), nil
+}
+
+func removeUserData(p *progress) error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	snailDir := filepath.Join(homeDir, ".snail")
+	for _, name := range []string{"internal", "plugins", "themes", "backups", "config.json"} {
+		path := filepath.Join(snailDir, name)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		p.log("Removed %s", path)
+	}
+
+	return nil
+}
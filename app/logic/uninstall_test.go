@@ -0,0 +1,79 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"snail-installer/fuses"
+	"testing"
+)
+
+func TestUninstallRemovesPatch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	appPath, binaryPath, asarPath := slackWithAsar(t)
+	if _, err := writeElectronFuse(appPath, fuses.EnableEmbeddedAsarIntegrityValidation, false); err != nil {
+		t.Fatal(err)
+	}
+	patchAsarFile(t, asarPath)
+
+	var steps []Step
+	err := Uninstall(UninstallOptions{
+		TargetPath: appPath,
+		Progress: func(ev ProgressEvent) {
+			if len(steps) == 0 || steps[len(steps)-1] != ev.Step {
+				steps = append(steps, ev.Step)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := asarPatchVersion(asarPath); v >= 0 {
+		t.Errorf("app.asar still has snail patch v%d", v)
+	}
+	if got := integrityFuse(t, binaryPath); got != fuses.Enabled {
+		t.Errorf("fuse is %s after uninstalling, want %s", got, fuses.Enabled)
+	}
+	for _, step := range steps {
+		found := false
+		for _, s := range UninstallSteps {
+			found = found || s == step
+		}
+		if !found {
+			t.Errorf("progress reported step %q, not one of UninstallSteps", step)
+		}
+	}
+}
+
+func TestUninstallCancelledLeavesSlack(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	appPath, binaryPath, asarPath := slackWithAsar(t)
+	if _, err := writeElectronFuse(appPath, fuses.EnableEmbeddedAsarIntegrityValidation, false); err != nil {
+		t.Fatal(err)
+	}
+	patchAsarFile(t, asarPath)
+	before, err := os.ReadFile(asarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Uninstall(UninstallOptions{TargetPath: appPath, Context: ctx})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	after, err := os.ReadFile(asarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("app.asar changed after a cancelled uninstall")
+	}
+	if got := integrityFuse(t, binaryPath); got != fuses.Disabled {
+		t.Errorf("fuse is %s after a cancelled uninstall, want %s", got, fuses.Disabled)
+	}
+}
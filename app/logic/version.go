@@ -0,0 +1,5 @@
+package logic
+
+// InstallerVersion is set at build time with
+// -ldflags "-X snail-installer/logic.InstallerVersion=v1.2.3"
+var InstallerVersion = "dev"
@@ -0,0 +1,197 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// slack updates replace app.asar (and on windows add a new app-x.y.z folder),
+// which quietly takes snail out again. Watch notices and patches again
+
+type WatchEventKind int
+
+const (
+	WatchPatchLost     WatchEventKind = iota // an install that had snail doesn't anymore
+	WatchRepatched                           // and it got patched again
+	WatchRepatchFailed                       // or that didn't work, Err says why
+)
+
+func (k WatchEventKind) String() string {
+	switch k {
+	case WatchPatchLost:
+		return "patch lost"
+	case WatchRepatched:
+		return "repatched"
+	case WatchRepatchFailed:
+		return "repatch failed"
+	}
+	return fmt.Sprintf("WatchEventKind(%d)", int(k))
+}
+
+type WatchEvent struct {
+	Kind    WatchEventKind
+	Install SlackInstall
+	Err     error
+}
+
+type WatchOptions struct {
+	Context context.Context
+	// patch again by itself, otherwise Notify is all that happens
+	Repatch bool
+	// called from the watching goroutine
+	Notify func(WatchEvent)
+	// how long things have to stay quiet before looking, updates write a lot
+	// of files and app.asar may not be complete yet. defaults to 10s
+	Settle time.Duration
+
+	// tests point these at a fake tree
+	discover func() []SlackInstall
+	install  func(InstallOptions) error
+}
+
+// Watch watches every Slack install it can find until the context is done
+func Watch(opts WatchOptions) error {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts.Settle == 0 {
+		opts.Settle = 10 * time.Second
+	}
+	if opts.discover == nil {
+		opts.discover = DiscoverSlackInstalls
+	}
+	if opts.install == nil {
+		opts.install = InstallSomething
+	}
+	notify := func(ev WatchEvent) {
+		if opts.Notify != nil {
+			opts.Notify(ev)
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+	defer watcher.Close()
+
+	// install types that had snail at some point. keyed by type and not path
+	// because a squirrel update comes back as a new app-x.y.z path
+	wanted := map[string]bool{}
+	// the update may have happened before we started watching, the history
+	// still knows where snail was installed
+	history, _ := InstallHistory()
+	for _, install := range opts.discover() {
+		_, root := watchDirs(install.AsarPath)
+		for _, h := range history {
+			asarPath, err := getAppAsarPath(h.SlackPath)
+			if err != nil {
+				continue
+			}
+			if _, hroot := watchDirs(asarPath); h.SlackPath == install.Path || hroot == root {
+				wanted[install.Type] = true
+			}
+		}
+	}
+	// installs we already told about, so a failed repatch isn't retried forever
+	reported := map[string]bool{}
+
+	check := func() {
+		installs := opts.discover()
+		for _, install := range installs {
+			watchInstall(watcher, install)
+		}
+
+		for _, install := range installs {
+			version, err := asarPatchVersion(install.AsarPath)
+			if err != nil {
+				// most likely caught halfway through an update, the next event tries again
+				println("Could not read", install.AsarPath+":", err.Error())
+				continue
+			}
+			if version >= 0 {
+				wanted[install.Type] = true
+				delete(reported, install.Path)
+				continue
+			}
+			if !wanted[install.Type] || reported[install.Path] {
+				continue
+			}
+			reported[install.Path] = true
+
+			println("snail patch is gone from", install.Path, "(Slack", install.Version+")")
+			notify(WatchEvent{Kind: WatchPatchLost, Install: install})
+			if !opts.Repatch {
+				continue
+			}
+
+			err = opts.install(InstallOptions{TargetPath: install.Path, Context: ctx})
+			if err != nil {
+				notify(WatchEvent{Kind: WatchRepatchFailed, Install: install, Err: err})
+				continue
+			}
+			// patched again, a later update should be caught again too
+			delete(reported, install.Path)
+			notify(WatchEvent{Kind: WatchRepatched, Install: install})
+		}
+	}
+
+	check()
+	if len(watcher.WatchList()) == 0 {
+		return fmt.Errorf("no Slack install found to watch")
+	}
+	println("Watching", len(watcher.WatchList()), "directories for Slack updates")
+
+	settle := time.NewTimer(opts.Settle)
+	settle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			settle.Reset(opts.Settle)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			println("Warning: watcher error:", err.Error())
+		case <-settle.C:
+			check()
+		}
+	}
+}
+
+// watchInstall watches the folder app.asar is in, and the folder the install
+// itself is in, for when the whole app gets swapped out (Slack.app on macOS,
+// new app-x.y.z folders on windows)
+func watchInstall(w *fsnotify.Watcher, install SlackInstall) {
+	resourcesDir, root := watchDirs(install.AsarPath)
+	for _, dir := range []string{resourcesDir, root} {
+		// adding something already watched is fine
+		if err := w.Add(dir); err != nil {
+			println("Warning: can't watch", dir+":", err.Error())
+		}
+	}
+}
+
+func watchDirs(asarPath string) (resourcesDir, root string) {
+	resourcesDir = filepath.Dir(asarPath)
+	appDir := filepath.Dir(resourcesDir)
+	if filepath.Base(appDir) == "Contents" {
+		// Slack.app/Contents/Resources
+		appDir = filepath.Dir(appDir)
+	}
+	return resourcesDir, filepath.Dir(appDir)
+}
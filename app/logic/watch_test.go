@@ -0,0 +1,126 @@
+package logic
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// watchedSlack is a patched linux install with a stock app.asar under it
+func watchedSlack(t *testing.T) (slackPath, asarPath string) {
+	t.Helper()
+	slackPath = filepath.Join(t.TempDir(), "slack")
+	asarPath, _ = appAsarPathFor("linux", slackPath)
+	if err := os.MkdirAll(filepath.Dir(asarPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(packApp(t, stockSlack), asarPath); err != nil {
+		t.Fatal(err)
+	}
+	patchAsarFile(t, asarPath)
+	return slackPath, asarPath
+}
+
+// an update that swaps in a stock app.asar gets noticed and patched again
+func TestWatchRepatchesAfterUpdate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	slackPath, asarPath := watchedSlack(t)
+	install := SlackInstall{Path: slackPath, AsarPath: asarPath, Version: "4.41.97", Type: "system"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events := make(chan WatchEvent, 10)
+	var installed []string
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(WatchOptions{
+			Context:  ctx,
+			Repatch:  true,
+			Settle:   50 * time.Millisecond,
+			Notify:   func(ev WatchEvent) { events <- ev },
+			discover: func() []SlackInstall { return []SlackInstall{install} },
+			install: func(opts InstallOptions) error {
+				installed = append(installed, opts.TargetPath)
+				patchAsarFile(t, asarPath)
+				return nil
+			},
+		})
+	}()
+
+	// give the watcher a moment to start before the "update"
+	time.Sleep(200 * time.Millisecond)
+	stock := packApp(t, stockSlack)
+	tmp := asarPath + ".update"
+	if err := copyFile(stock, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, asarPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []WatchEventKind{WatchPatchLost, WatchRepatched} {
+		select {
+		case ev := <-events:
+			if ev.Kind != want || ev.Install.Path != slackPath {
+				t.Fatalf("got %s for %s, want %s", ev.Kind, ev.Install.Path, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("no %s event", want)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(installed) != 1 || installed[0] != slackPath {
+		t.Errorf("installed into %v, want just %s", installed, slackPath)
+	}
+	if v, _ := asarPatchVersion(asarPath); v != PatchVersion {
+		t.Errorf("patch version %d after the repatch", v)
+	}
+}
+
+// without Repatch it only tells
+func TestWatchNotifiesOnly(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	slackPath, asarPath := watchedSlack(t)
+	install := SlackInstall{Path: slackPath, AsarPath: asarPath, Type: "system"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events := make(chan WatchEvent, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(WatchOptions{
+			Context:  ctx,
+			Settle:   50 * time.Millisecond,
+			Notify:   func(ev WatchEvent) { events <- ev },
+			discover: func() []SlackInstall { return []SlackInstall{install} },
+			install: func(InstallOptions) error {
+				t.Error("installed without Repatch")
+				return nil
+			},
+		})
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	if err := copyFile(packApp(t, stockSlack), asarPath); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Kind != WatchPatchLost {
+			t.Errorf("got %s, want %s", ev.Kind, WatchPatchLost)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event")
+	}
+	cancel()
+	<-done
+}
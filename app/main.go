@@ -1,8 +1,11 @@
 package main
 
 import (
+	"os"
+	"snail-installer/cli"
 	"snail-installer/logic"
 	"snail-installer/ui"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -21,17 +24,28 @@ func main() {
 	if logic.AppSettings.ServerURL == "" {
 		logic.AppSettings.ServerURL = baseServerUrl
 	}
+
+	// any arguments means headless, never start the gui
+	// (older macOS passes -psn_... when launching from finder)
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-psn_") {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	a := app.New()
 	w := a.NewWindow("snail installer")
 	w.Resize(fyne.NewSize(500, 350))
 
 	installPage := ui.NewInstallPage(w)
-	// restorePage := ui.NewRestorePage(w)
+	restorePage := ui.NewRestorePage(w)
+	statusPage := ui.NewStatusPage(w)
+	pluginsPage := ui.NewPluginsPage(w)
 	settingsPage := ui.NewSettingsPage(w)
 
 	tabs := container.NewAppTabs(
 		container.NewTabItem("Install", installPage),
-		// container.NewTabItem("Restore", restorePage),
+		container.NewTabItem("Restore", restorePage),
+		container.NewTabItem("Status", statusPage),
+		container.NewTabItem("Plugins", pluginsPage),
 		container.NewTabItem("Settings", settingsPage),
 	)
 
@@ -0,0 +1,427 @@
+package plugins
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// what the loader's SNAIL_* handlers in core/src/main.ts do, from outside
+// slack: a plugin is a folder in ~/.snail/plugins with a manifest.json, it
+// is enabled when its folder name is in pluginsEnabled in ~/.snail/config.json.
+// themes are the same with themes/ and themesEnabled. the loader only reads
+// them when slack starts
+
+type Kind string
+
+const (
+	Plugin Kind = "plugin"
+	Theme  Kind = "theme"
+)
+
+func (k Kind) folder() string {
+	return string(k) + "s"
+}
+
+func (k Kind) configKey() string {
+	return string(k) + "sEnabled"
+}
+
+type Manifest struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Author      any    `json:"author,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Entry       string `json:"entry,omitempty"`
+	// one file or a list of them
+	CSS any `json:"css,omitempty"`
+}
+
+// Item is a plugin or theme like SNAIL_GET_PLUGIN_LIST returns it, with
+// the same defaults for what the manifest leaves out
+type Item struct {
+	ID          string   `json:"id"`
+	Kind        Kind     `json:"kind"`
+	Path        string   `json:"path"`
+	Enabled     bool     `json:"enabled"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Version     string   `json:"version"`
+	Author      any      `json:"author,omitempty"`
+	Icon        string   `json:"icon,omitempty"`
+	Manifest    Manifest `json:"manifest"`
+}
+
+// AuthorName is the author as text, manifests have either a name or an
+// object with one
+func (i Item) AuthorName() string {
+	switch a := i.Author.(type) {
+	case string:
+		return a
+	case map[string]any:
+		name, _ := a["name"].(string)
+		return name
+	}
+	return ""
+}
+
+func snailDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".snail"), nil
+}
+
+// Dir is where plugins or themes are installed
+func Dir(kind Kind) (string, error) {
+	dir, err := snailDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, kind.folder()), nil
+}
+
+func configPath() (string, error) {
+	dir, err := snailDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// validID is a folder name that stays inside the plugins folder
+func validID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, `/\`) && filepath.IsLocal(id)
+}
+
+func readManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: manifest.json is not valid: %w", filepath.Base(dir), err)
+	}
+	return &m, nil
+}
+
+// List returns the installed plugins or themes in name order. like the
+// loader it leaves out folders without a readable manifest, and counts
+// nothing as enabled when config.json can't be read
+func List(kind Kind) ([]Item, error) {
+	dir, err := Dir(kind)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := map[string]bool{}
+	if config, err := readConfig(); err == nil {
+		for _, id := range enabledIDs(config, kind) {
+			enabled[id] = true
+		}
+	}
+
+	var items []Item
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		m, err := readManifest(p)
+		if err != nil {
+			continue
+		}
+		item := Item{
+			ID:          e.Name(),
+			Kind:        kind,
+			Path:        p,
+			Enabled:     enabled[e.Name()],
+			Name:        m.Name,
+			Description: m.Description,
+			Version:     m.Version,
+			Author:      m.Author,
+			Icon:        m.Icon,
+			Manifest:    *m,
+		}
+		if item.Name == "" {
+			item.Name = item.ID
+		}
+		if item.Version == "" {
+			item.Version = "1.0.0"
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Enable makes slack load an installed plugin or theme
+func Enable(kind Kind, id string) error {
+	dir, err := Dir(kind)
+	if err != nil {
+		return err
+	}
+	if !validID(id) {
+		return fmt.Errorf("invalid %s id %q", kind, id)
+	}
+	if _, err := readManifest(filepath.Join(dir, id)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("no %s %q in %s", kind, id, dir)
+		}
+		return err
+	}
+
+	return updateEnabled(kind, func(ids []string) []string {
+		for _, other := range ids {
+			if other == id {
+				return ids
+			}
+		}
+		return append(ids, id)
+	})
+}
+
+// Disable stops slack loading a plugin or theme. it works for ids that
+// aren't installed too, so a stale entry can be cleaned up
+func Disable(kind Kind, id string) error {
+	return updateEnabled(kind, func(ids []string) []string {
+		kept := []string{}
+		for _, other := range ids {
+			if other != id {
+				kept = append(kept, other)
+			}
+		}
+		return kept
+	})
+}
+
+// Remove deletes a plugin or theme and takes it out of config.json
+func Remove(kind Kind, id string) error {
+	dir, err := Dir(kind)
+	if err != nil {
+		return err
+	}
+	if !validID(id) {
+		return fmt.Errorf("invalid %s id %q", kind, id)
+	}
+	p := filepath.Join(dir, id)
+	if _, err := os.Lstat(p); err != nil {
+		return fmt.Errorf("no %s %q in %s", kind, id, dir)
+	}
+	if err := os.RemoveAll(p); err != nil {
+		return err
+	}
+	if err := Disable(kind, id); err != nil {
+		return fmt.Errorf("removed %s but could not update config.json: %w", p, err)
+	}
+	return nil
+}
+
+func readConfig() (map[string]any, error) {
+	p, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return map[string]any{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s is not valid JSON: %w", p, err)
+	}
+	if config == nil {
+		config = map[string]any{}
+	}
+	return config, nil
+}
+
+func enabledIDs(config map[string]any, kind Kind) []string {
+	list, _ := config[kind.configKey()].([]any)
+	ids := []string{}
+	for _, v := range list {
+		if id, ok := v.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// updateEnabled rewrites one list in config.json, keeping every other key.
+// a config that isn't valid JSON is left alone instead of being replaced
+func updateEnabled(kind Kind, update func([]string) []string) error {
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	config[kind.configKey()] = update(enabledIDs(config, kind))
+
+	p, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// Install unpacks a plugin or theme zip and returns the ids it installed.
+// a zip holds one folder per plugin, like the loader expects, or a single
+// plugin with manifest.json at the top which gets the zip's name.
+// an installed plugin with the same id is replaced, not merged into
+func Install(kind Kind, zipPath string) ([]string, error) {
+	dir, err := Dir(kind)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", zipPath, err)
+	}
+	defer zr.Close()
+
+	var files []*zip.File
+	rootManifest := false
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, "./")
+		// finder adds these to every zip it makes
+		if name == "" || strings.HasPrefix(name, "__MACOSX/") || path.Base(name) == ".DS_Store" {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(strings.TrimSuffix(name, "/"))) || strings.Contains(name, `\`) {
+			return nil, fmt.Errorf("%s: %s would end up outside the %s folder", zipPath, f.Name, kind)
+		}
+		if f.Mode()&fs.ModeSymlink != 0 {
+			return nil, fmt.Errorf("%s: %s is a symlink", zipPath, f.Name)
+		}
+		if name == "manifest.json" {
+			rootManifest = true
+		}
+		files = append(files, f)
+	}
+
+	// where each zip entry goes, relative to the plugins folder
+	target := func(f *zip.File) string {
+		return strings.TrimPrefix(f.Name, "./")
+	}
+	if rootManifest {
+		id := strings.TrimSuffix(filepath.Base(zipPath), filepath.Ext(zipPath))
+		if !validID(id) {
+			return nil, fmt.Errorf("can't name a %s after %s", kind, zipPath)
+		}
+		target = func(f *zip.File) string {
+			return id + "/" + strings.TrimPrefix(f.Name, "./")
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	// next to the real folders so they can be renamed into place
+	staging, err := os.MkdirTemp(dir, ".install-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	idSet := map[string]bool{}
+	for _, f := range files {
+		name := target(f)
+		id, _, nested := strings.Cut(strings.TrimSuffix(name, "/"), "/")
+		if !nested && !f.FileInfo().IsDir() {
+			return nil, fmt.Errorf("%s: %s is not in a %s folder", zipPath, f.Name, kind)
+		}
+		if !validID(id) {
+			return nil, fmt.Errorf("%s: invalid %s folder %q", zipPath, kind, id)
+		}
+		idSet[id] = true
+
+		dest := filepath.Join(staging, filepath.FromSlash(name))
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := extractFile(f, dest); err != nil {
+			return nil, fmt.Errorf("failed to unzip %s: %w", f.Name, err)
+		}
+	}
+	if len(idSet) == 0 {
+		return nil, fmt.Errorf("%s has no %s in it", zipPath, kind)
+	}
+
+	ids := make([]string, 0, len(idSet))
+	for id := range idSet {
+		// the loader would skip it without telling anyone
+		if _, err := readManifest(filepath.Join(staging, id)); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("%s: %s has no manifest.json", zipPath, id)
+			}
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		dest := filepath.Join(dir, id)
+		if err := os.RemoveAll(dest); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(filepath.Join(staging, id), dest); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func extractFile(f *zip.File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, src)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
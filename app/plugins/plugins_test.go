@@ -0,0 +1,268 @@
+package plugins
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// home makes a temp home with ~/.snail/plugins/<id>/manifest.json for each
+// manifest, "" leaves the manifest out
+func home(t *testing.T, kind Kind, manifests map[string]string) string {
+	t.Helper()
+	h := t.TempDir()
+	t.Setenv("HOME", h)
+	t.Setenv("USERPROFILE", h)
+	for id, manifest := range manifests {
+		dir := filepath.Join(h, ".snail", kind.folder(), id)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if manifest == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h
+}
+
+func writeConfig(t *testing.T, h, config string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(h, ".snail", "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readConfigFile(t *testing.T, h string) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(h, ".snail", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestList(t *testing.T) {
+	manifests := map[string]string{
+		"full":     `{"name":"Full","description":"does things","version":"2.1.0","author":{"name":"someone"}}`,
+		"bare":     `{}`,
+		"nothing":  "",
+		"broken":   `{"name":`,
+		"disabled": `{"name":"Off"}`,
+	}
+	tests := []struct {
+		name    string
+		kind    Kind
+		config  string
+		enabled map[string]bool
+	}{
+		{"plugins", Plugin, `{"pluginsEnabled":["full","bare","gone"],"themesEnabled":["disabled"]}`, map[string]bool{"full": true, "bare": true}},
+		{"themes", Theme, `{"pluginsEnabled":["full"],"themesEnabled":["disabled"]}`, map[string]bool{"disabled": true}},
+		{"no config", Plugin, "", map[string]bool{}},
+		// the loader falls back to nothing enabled too
+		{"broken config", Plugin, `{"pluginsEnabled":["full"`, map[string]bool{}},
+		{"not a list", Plugin, `{"pluginsEnabled":"full"}`, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := home(t, tt.kind, manifests)
+			if tt.config != "" {
+				writeConfig(t, h, tt.config)
+			}
+
+			items, err := List(tt.kind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, item := range items {
+				ids = append(ids, item.ID)
+				if item.Enabled != tt.enabled[item.ID] {
+					t.Errorf("%s enabled = %v, want %v", item.ID, item.Enabled, tt.enabled[item.ID])
+				}
+				if item.Kind != tt.kind {
+					t.Errorf("%s kind = %s, want %s", item.ID, item.Kind, tt.kind)
+				}
+			}
+			// folders without a readable manifest are left out
+			if want := []string{"bare", "disabled", "full"}; !reflect.DeepEqual(ids, want) {
+				t.Fatalf("listed %v, want %v", ids, want)
+			}
+
+			bare, full := items[0], items[2]
+			if bare.Name != "bare" || bare.Version != "1.0.0" || bare.Description != "" {
+				t.Errorf("bare got name %q version %q description %q, want the loader's defaults", bare.Name, bare.Version, bare.Description)
+			}
+			if full.Name != "Full" || full.Version != "2.1.0" || full.AuthorName() != "someone" {
+				t.Errorf("full got name %q version %q author %q", full.Name, full.Version, full.AuthorName())
+			}
+		})
+	}
+}
+
+func TestListWithoutFolder(t *testing.T) {
+	home(t, Plugin, nil)
+	items, err := List(Theme)
+	if err != nil || items != nil {
+		t.Fatalf("got %v, %v, want nothing", items, err)
+	}
+}
+
+// the config has keys the installer doesn't know about, they must come
+// out of every change the way they went in
+const configWithExtras = `{
+  "serverUrl": "https://example.com/",
+  "loaderVersion": "v1.2.3",
+  "someFutureKey": {"nested": [1, "two", null], "on": true},
+  "themesEnabled": ["dark"],
+  "pluginsEnabled": ["one"]
+}`
+
+func TestEnableDisable(t *testing.T) {
+	manifests := map[string]string{"one": `{}`, "two": `{}`, "three": `{}`, "nomanifest": ""}
+	tests := []struct {
+		name    string
+		config  string
+		change  func() error
+		wantErr bool
+		want    []any
+	}{
+		{"enable appends", configWithExtras, func() error { return Enable(Plugin, "two") }, false, []any{"one", "two"}},
+		{"enable twice", configWithExtras, func() error { return Enable(Plugin, "one") }, false, []any{"one"}},
+		{"enable without config", "", func() error { return Enable(Plugin, "three") }, false, []any{"three"}},
+		{"enable not installed", configWithExtras, func() error { return Enable(Plugin, "missing") }, true, []any{"one"}},
+		{"enable without manifest", configWithExtras, func() error { return Enable(Plugin, "nomanifest") }, true, []any{"one"}},
+		{"enable outside the folder", configWithExtras, func() error { return Enable(Plugin, "../one") }, true, []any{"one"}},
+		{"disable", configWithExtras, func() error { return Disable(Plugin, "one") }, false, []any{}},
+		// SNAIL_DISABLE_PLUGIN filters, so every copy goes
+		{"disable duplicates", `{"pluginsEnabled":["one","two","one"],"someFutureKey":{"nested":[1,"two",null],"on":true}}`, func() error { return Disable(Plugin, "one") }, false, []any{"two"}},
+		// a stale entry for something already deleted
+		{"disable not installed", `{"pluginsEnabled":["gone","one"]}`, func() error { return Disable(Plugin, "gone") }, false, []any{"one"}},
+		{"disable not enabled", configWithExtras, func() error { return Disable(Plugin, "two") }, false, []any{"one"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := home(t, Plugin, manifests)
+			if tt.config != "" {
+				writeConfig(t, h, tt.config)
+			}
+			var before map[string]any
+			if tt.config != "" {
+				before = readConfigFile(t, h)
+			}
+
+			err := tt.change()
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatal(err)
+			}
+
+			after := readConfigFile(t, h)
+			if got := after["pluginsEnabled"]; !reflect.DeepEqual(got, any(tt.want)) {
+				t.Errorf("pluginsEnabled = %v, want %v", got, tt.want)
+			}
+			for key, value := range before {
+				if key == "pluginsEnabled" {
+					continue
+				}
+				if !reflect.DeepEqual(after[key], value) {
+					t.Errorf("%s changed from %v to %v", key, value, after[key])
+				}
+			}
+		})
+	}
+}
+
+func TestBrokenConfigIsLeftAlone(t *testing.T) {
+	h := home(t, Plugin, map[string]string{"one": `{}`})
+	broken := `{"pluginsEnabled":["one"], oops}`
+	writeConfig(t, h, broken)
+
+	for name, change := range map[string]func() error{
+		"enable":  func() error { return Enable(Plugin, "one") },
+		"disable": func() error { return Disable(Plugin, "one") },
+	} {
+		if err := change(); err == nil {
+			t.Errorf("%s: rewrote a config that isn't valid JSON", name)
+		}
+		data, err := os.ReadFile(filepath.Join(h, ".snail", "config.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != broken {
+			t.Errorf("%s: config.json changed to %q", name, data)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    Kind
+		id      string
+		wantErr bool
+		want    []string
+	}{
+		{"enabled plugin", Plugin, "one", false, []string{"two"}},
+		{"disabled plugin", Plugin, "two", false, []string{"one"}},
+		{"theme", Theme, "dark", false, nil},
+		{"not installed", Plugin, "missing", true, []string{"one", "two"}},
+		{"outside the folder", Plugin, "..", true, []string{"one", "two"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifests := map[string]string{"one": `{}`, "two": `{}`}
+			if tt.kind == Theme {
+				manifests = map[string]string{"dark": `{}`}
+			}
+			h := home(t, tt.kind, manifests)
+			writeConfig(t, h, configWithExtras)
+			before := readConfigFile(t, h)
+
+			err := Remove(tt.kind, tt.id)
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatal(err)
+			}
+
+			items, err := List(tt.kind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("left %v installed, want %v", ids, tt.want)
+			}
+
+			after := readConfigFile(t, h)
+			for _, v := range after[tt.kind.configKey()].([]any) {
+				if v == tt.id && !tt.wantErr {
+					t.Errorf("%s is still in %s", tt.id, tt.kind.configKey())
+				}
+			}
+			for key, value := range before {
+				if key == tt.kind.configKey() {
+					continue
+				}
+				if !reflect.DeepEqual(after[key], value) {
+					t.Errorf("%s changed from %v to %v", key, value, after[key])
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package ui
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"snail-installer/fuses"
 	"snail-installer/logic"
 
 	"fyne.io/fyne/v2"
@@ -12,10 +16,34 @@ import (
 
 func NewInstallPage(win fyne.Window) fyne.CanvasObject {
 
-	pathEntry := widget.NewEntry()
-	pathEntry.SetPlaceHolder("/Applications/Slack.app/")
+	pathEntry, row := newSlackPathRow()
 
-	installBtn := widget.NewButton("Install", func() {
+	bundleEntry := widget.NewEntry()
+	bundleEntry.SetPlaceHolder("Offline bundle .zip (optional)")
+
+	selectBundleBtn := widget.NewButton("Select Bundle", func() {
+		path, err := zenity.SelectFile(zenity.FileFilter{Name: "snail bundle", Patterns: []string{"*.zip"}})
+		if err == nil {
+			bundleEntry.SetText(path)
+		}
+	})
+	bundleRow := container.NewBorder(nil, nil, nil, selectBundleBtn, bundleEntry)
+
+	progressPane := newProgressPane()
+
+	var installBtn, uninstallBtn *widget.Button
+	// one thing at a time through the progress pane
+	setBusy := func(busy bool) {
+		if busy {
+			installBtn.Disable()
+			uninstallBtn.Disable()
+		} else {
+			installBtn.Enable()
+			uninstallBtn.Enable()
+		}
+	}
+
+	installBtn = widget.NewButton("Install", func() {
 		// if nothing, ask to select the app
 
 		if pathEntry.Text == "" {
@@ -23,41 +51,122 @@ func NewInstallPage(win fyne.Window) fyne.CanvasObject {
 			return
 		}
 
+		ctx, onProgress := progressPane.start(logic.InstallSteps)
 		opts := logic.InstallOptions{
 			TargetPath: pathEntry.Text,
+			BundlePath: bundleEntry.Text,
+			Context:    ctx,
+			Progress:   onProgress,
 		}
 
-		err := logic.InstallSomething(opts)
-		if err != nil {
-			dialog.ShowError(err, win)
+		setBusy(true)
+		go func() {
+			err := logic.InstallSomething(opts)
+
+			fyne.Do(func() {
+				progressPane.done()
+				setBusy(false)
+
+				if errors.Is(err, context.Canceled) {
+					dialog.ShowInformation("Cancelled", "Installation was cancelled, Slack was not changed.", win)
+					return
+				}
+				if err != nil {
+					dialog.ShowError(err, win)
+					return
+				}
+
+				dialog.ShowInformation("Success", "Installation completed!", win)
+			})
+		}()
+	})
+
+	removeDataCheck := widget.NewCheck("Also delete plugins, themes and backups in ~/.snail", nil)
+
+	uninstallBtn = widget.NewButton("Uninstall", func() {
+		if pathEntry.Text == "" {
+			dialog.ShowInformation("Info", "Please select the slack app \\o/", win)
 			return
 		}
 
-		dialog.ShowInformation("Success", "Installation completed!", win)
+		confirm := dialog.NewConfirm("Confirm Uninstall",
+			"This will remove snail from Slack and turn asar integrity validation back on.",
+			func(confirmed bool) {
+				if !confirmed {
+					return
+				}
+
+				ctx, onProgress := progressPane.start(logic.UninstallSteps)
+				opts := logic.UninstallOptions{
+					TargetPath:     pathEntry.Text,
+					RemoveUserData: removeDataCheck.Checked,
+					Context:        ctx,
+					Progress:       onProgress,
+				}
+
+				setBusy(true)
+				go func() {
+					err := logic.Uninstall(opts)
+
+					fyne.Do(func() {
+						progressPane.done()
+						setBusy(false)
+
+						if errors.Is(err, context.Canceled) {
+							dialog.ShowInformation("Cancelled", "Uninstall was cancelled, Slack was not changed.", win)
+							return
+						}
+						if err != nil {
+							dialog.ShowError(err, win)
+							return
+						}
+
+						dialog.ShowInformation("Success", "snail was removed from Slack.", win)
+					})
+				}()
+			}, win)
+		confirm.Show()
 	})
 
-	selectFileBtn := widget.NewButton("Select File", func() {
-		path, err := zenity.SelectFile()
-		if err == nil {
-			pathEntry.SetText(path)
+	inspectFusesBtn := widget.NewButton("Inspect fuses", func() {
+		if pathEntry.Text == "" {
+			dialog.ShowInformation("Info", "Please select the slack app \\o/", win)
+			return
 		}
-	})
 
-	// Row: entry expands, button stays fixed
-	row := container.NewBorder(
-		nil,           // top
-		nil,           // bottom
-		nil,           // left
-		selectFileBtn, // right
-		pathEntry,     // center expands
-	)
+		bin, err := logic.InspectFuses(pathEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+
+		text := fmt.Sprintf("%s (%s)\n", bin.Path, bin.Format)
+		for i, wire := range bin.Wires {
+			text += fmt.Sprintf("\nwire %d at offset %d, version %d\n", i+1, wire.Offset, wire.Version)
+			for j, state := range wire.States {
+				text += fmt.Sprintf("  %s: %s\n", fuses.Fuse(j), state)
+			}
+		}
+
+		label := widget.NewLabel(text)
+		label.Wrapping = fyne.TextWrapWord
+		scroll := container.NewVScroll(label)
+		scroll.SetMinSize(fyne.NewSize(450, 300))
+		dialog.ShowCustom("Electron fuses", "Close", scroll, win)
+	})
 
 	return container.NewVBox(
 		container.NewPadded(
 			container.NewVBox(
 				widget.NewLabel("Slack app path:"),
 				row,
+				bundleRow,
 				installBtn,
+				progressPane.Object(),
+				inspectFusesBtn,
+				widget.NewSeparator(),
+				removeDataCheck,
+				uninstallBtn,
 			),
 		),
 	)
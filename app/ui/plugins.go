@@ -0,0 +1,131 @@
+package ui
+
+import (
+	"fmt"
+	"snail-installer/plugins"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ncruces/zenity"
+)
+
+// NewPluginsPage lists plugins and themes like snail's settings in slack do,
+// so one that breaks slack can be turned off from out here
+func NewPluginsPage(win fyne.Window) fyne.CanvasObject {
+	kind := plugins.Plugin
+
+	scrollArea := container.NewScroll(widget.NewLabel("Loading..."))
+
+	var updateList func()
+	updateList = func() {
+		items, err := plugins.List(kind)
+		if err != nil {
+			scrollArea.Content = widget.NewLabel("Could not list " + string(kind) + "s: " + err.Error())
+			scrollArea.Refresh()
+			return
+		}
+		if len(items) == 0 {
+			dir, _ := plugins.Dir(kind)
+			scrollArea.Content = widget.NewLabel(fmt.Sprintf("No %ss installed in %s.", kind, dir))
+			scrollArea.Refresh()
+			return
+		}
+
+		list := container.NewVBox()
+		for _, item := range items {
+			it := item
+			subtitle := it.ID + ", " + it.Version
+			if author := it.AuthorName(); author != "" {
+				subtitle += " by " + author
+			}
+			card := widget.NewCard(it.Name, subtitle, nil)
+
+			enabledCheck := widget.NewCheck("Enabled", nil)
+			enabledCheck.SetChecked(it.Enabled)
+			enabledCheck.OnChanged = func(on bool) {
+				var err error
+				if on {
+					err = plugins.Enable(it.Kind, it.ID)
+				} else {
+					err = plugins.Disable(it.Kind, it.ID)
+				}
+				if err != nil {
+					dialog.ShowError(err, win)
+					updateList()
+				}
+			}
+
+			removeBtn := widget.NewButton("Remove", func() {
+				dialog.ShowConfirm("Remove "+it.Name,
+					fmt.Sprintf("Delete %s? This removes its folder from ~/.snail/%ss.", it.Name, it.Kind),
+					func(confirmed bool) {
+						if !confirmed {
+							return
+						}
+						if err := plugins.Remove(it.Kind, it.ID); err != nil {
+							dialog.ShowError(err, win)
+						}
+						updateList()
+					}, win)
+			})
+			removeBtn.Importance = widget.DangerImportance
+
+			details := container.NewVBox()
+			if it.Description != "" {
+				description := widget.NewLabel(it.Description)
+				description.Wrapping = fyne.TextWrapWord
+				details.Add(description)
+			}
+			details.Add(container.NewBorder(nil, nil, enabledCheck, removeBtn))
+			card.SetContent(details)
+			list.Add(card)
+		}
+
+		scrollArea.Content = list
+		scrollArea.Refresh()
+	}
+
+	kindSelect := widget.NewRadioGroup([]string{"Plugins", "Themes"}, func(s string) {
+		if s == "Themes" {
+			kind = plugins.Theme
+		} else {
+			kind = plugins.Plugin
+		}
+		updateList()
+	})
+	kindSelect.Horizontal = true
+	kindSelect.Required = true
+	kindSelect.SetSelected("Plugins")
+
+	installBtn := widget.NewButton("Install from zip", func() {
+		path, err := zenity.SelectFile(zenity.FileFilter{Name: "zip files", Patterns: []string{"*.zip"}})
+		if err != nil {
+			return
+		}
+		ids, err := plugins.Install(kind, path)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		dialog.ShowInformation("Installed", fmt.Sprintf("Installed %s. Enable it below, it loads the next time Slack starts.", strings.Join(ids, ", ")), win)
+		updateList()
+	})
+
+	refreshBtn := widget.NewButton("Refresh", func() {
+		updateList()
+	})
+
+	hint := widget.NewLabel("Changes apply the next time Slack starts.")
+	hint.Wrapping = fyne.TextWrapWord
+
+	return container.NewBorder(
+		container.NewVBox(
+			container.NewBorder(nil, nil, kindSelect, container.NewHBox(installBtn, refreshBtn)),
+			hint,
+		), nil, nil, nil,
+		scrollArea,
+	)
+}
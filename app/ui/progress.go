@@ -0,0 +1,144 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"snail-installer/logic"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// progressPane shows which step of an install or uninstall we're on, a
+// progress bar and the log. events come in from the goroutine doing the work
+// and get moved onto the ui thread
+type progressPane struct {
+	bar       *widget.ProgressBar
+	stepLabel *widget.Label
+	log       *widget.Label
+	logScroll *container.Scroll
+	cancelBtn *widget.Button
+
+	cancel context.CancelFunc
+	steps  []logic.Step
+	lines  []string
+}
+
+func newProgressPane() *progressPane {
+	p := &progressPane{
+		bar:       widget.NewProgressBar(),
+		stepLabel: widget.NewLabel(""),
+		log:       widget.NewLabel(""),
+	}
+	p.bar.TextFormatter = func() string {
+		return fmt.Sprintf("%.0f%%", p.bar.Value/p.bar.Max*100)
+	}
+	p.log.Wrapping = fyne.TextWrapWord
+	p.logScroll = container.NewVScroll(p.log)
+	p.logScroll.SetMinSize(fyne.NewSize(0, 150))
+
+	p.cancelBtn = widget.NewButton("Cancel", func() {
+		if p.cancel != nil {
+			p.cancel()
+		}
+		p.cancelBtn.Disable()
+	})
+	p.cancelBtn.Disable()
+
+	return p
+}
+
+func (p *progressPane) Object() fyne.CanvasObject {
+	return container.NewVBox(
+		container.NewBorder(nil, nil, nil, p.cancelBtn, p.stepLabel),
+		p.bar,
+		p.logScroll,
+	)
+}
+
+// start resets the pane for something that goes through steps, and returns
+// the context and callback to hand it
+func (p *progressPane) start(steps []logic.Step) (context.Context, logic.ProgressFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.steps = steps
+	p.bar.Max = float64(len(steps))
+	p.lines = nil
+	p.log.SetText("")
+	p.bar.SetValue(0)
+	p.stepLabel.SetText("")
+	p.cancelBtn.Enable()
+
+	// only touched from the goroutine doing the work
+	var lastFrac float64
+
+	return ctx, func(ev logic.ProgressEvent) {
+		// bytes come in per 32k chunk, only bother the ui for whole percents
+		switch ev.Kind {
+		case logic.EventStart:
+			lastFrac = 0
+		case logic.EventBytes:
+			if ev.Total <= 0 {
+				return
+			}
+			frac := float64(ev.Done) / float64(ev.Total)
+			if frac-lastFrac < 0.01 && frac < 1 {
+				return
+			}
+			lastFrac = frac
+		}
+		fyne.Do(func() { p.handle(ev) })
+	}
+}
+
+// done stops offering cancel once the work returned
+func (p *progressPane) done() {
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+	p.cancelBtn.Disable()
+}
+
+func (p *progressPane) stepIndex(step logic.Step) int {
+	for i, s := range p.steps {
+		if s == step {
+			return i
+		}
+	}
+	return 0
+}
+
+func (p *progressPane) handle(ev logic.ProgressEvent) {
+	i := p.stepIndex(ev.Step)
+
+	switch ev.Kind {
+	case logic.EventStart:
+		p.stepLabel.SetText(fmt.Sprintf("%d/%d %s...", i+1, len(p.steps), ev.Step))
+		p.bar.SetValue(float64(i))
+		// the original app.asar gets overwritten from here on, can't stop now
+		if ev.Step == logic.StepReplace {
+			p.cancelBtn.Disable()
+		}
+	case logic.EventFinish:
+		p.bar.SetValue(float64(i + 1))
+		p.appendLine(fmt.Sprintf("done: %s", ev.Step))
+	case logic.EventFail:
+		p.stepLabel.SetText(fmt.Sprintf("%s failed", ev.Step))
+		p.appendLine(fmt.Sprintf("failed: %s: %v", ev.Step, ev.Err))
+	case logic.EventBytes:
+		if ev.Total > 0 {
+			p.bar.SetValue(float64(i) + float64(ev.Done)/float64(ev.Total))
+		}
+	case logic.EventLog:
+		p.appendLine(ev.Message)
+	}
+}
+
+func (p *progressPane) appendLine(line string) {
+	p.lines = append(p.lines, line)
+	p.log.SetText(strings.Join(p.lines, "\n"))
+	p.logScroll.ScrollToBottom()
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"fmt"
 	"snail-installer/logic"
 	"sort"
 
@@ -14,17 +15,27 @@ func NewRestorePage(win fyne.Window) fyne.CanvasObject {
 
 	backups := logic.GetBackupList()
 
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].Time.After(backups[j].Time)
-	})
+	pathEntry, pathRow := newSlackPathRow()
 
 	refreshBtn := widget.NewButton("Refresh", func() {
 		backups = logic.GetBackupList()
 	})
 
 	scrollArea := container.NewScroll(widget.NewLabel("Loading..."))
+	usageLabel := widget.NewLabel("")
+
+	var updateList func()
+	updateList = func() {
+		if logical, onDisk, err := logic.BackupUsage(); err == nil && logical > 0 {
+			usageLabel.SetText(fmt.Sprintf("%.1f MB of backups, %.1f MB on disk", float64(logical)/(1<<20), float64(onDisk)/(1<<20)))
+		} else {
+			usageLabel.SetText("")
+		}
+
+		sort.Slice(backups, func(i, j int) bool {
+			return backups[i].Time.After(backups[j].Time)
+		})
 
-	updateList := func() {
 		if len(backups) == 0 {
 			scrollArea.Content = widget.NewLabel("No backups found.")
 			scrollArea.Refresh()
@@ -35,26 +46,42 @@ func NewRestorePage(win fyne.Window) fyne.CanvasObject {
 		for _, backup := range backups {
 			backupTime := backup.Time.Format("2006-01-02 15:04:05")
 			b := backup
-			backupCard := widget.NewCard("Backup from "+backupTime, "", nil)
+			backupCard := widget.NewCard("Backup from "+backupTime, backupSubtitle(b), nil)
 			restoreBtn := widget.NewButton("Restore", func() {
+				if pathEntry.Text == "" {
+					dialog.ShowInformation("Info", "Please select the slack app \\o/", win)
+					return
+				}
+
 				confirm := dialog.NewConfirm("Confirm Restore",
 					"Are you sure you want to restore this backup? This will overwrite your current installation.",
 					func(confirmed bool) {
 						if confirmed {
-							err := logic.RestoreBackup("", "")
+							err := logic.RestoreBackup(b.Filepath, pathEntry.Text)
 							if err != nil {
 								dialog.ShowError(err, win)
 							} else {
-								dialog.ShowInformation("Success", "Backup restored successfully.", win)
+								dialog.ShowInformation("Success", "Backup restored successfully. The previous app.asar was kept as a new backup.", win)
+								backups = logic.GetBackupList()
+								updateList()
 							}
 						}
 					}, win)
 				confirm.Show()
 			})
-			backupCard.SetContent(container.NewVBox(
-				widget.NewLabel("File: "+b.Filepath),
-				restoreBtn,
-			))
+			details := container.NewVBox(widget.NewLabel("File: " + b.Filepath))
+			if b.Meta != nil {
+				details.Add(widget.NewLabel(fmt.Sprintf("From %s, %.1f MB", b.Meta.SourcePath, float64(b.Meta.Size)/(1<<20))))
+				details.Add(widget.NewLabel(fmt.Sprintf("sha256 %s…, installer %s", b.Meta.SHA256[:min(12, len(b.Meta.SHA256))], b.Meta.InstallerVersion)))
+			}
+			if b.Corrupt != "" {
+				label := widget.NewLabel("Corrupt: " + b.Corrupt)
+				label.Importance = widget.DangerImportance
+				details.Add(label)
+				restoreBtn.Disable()
+			}
+			details.Add(restoreBtn)
+			backupCard.SetContent(details)
 			backupList.Add(backupCard)
 		}
 
@@ -70,7 +97,23 @@ func NewRestorePage(win fyne.Window) fyne.CanvasObject {
 	}
 
 	return container.NewBorder(
-		refreshBtn, nil, nil, nil,
+		container.NewVBox(
+			widget.NewLabel("Slack app path:"),
+			pathRow,
+			refreshBtn,
+			usageLabel,
+		), nil, nil, nil,
 		scrollArea,
 	)
 }
+
+func backupSubtitle(b logic.Backup) string {
+	if b.Meta == nil {
+		return "no details, made by an older installer"
+	}
+	state := "untouched"
+	if !b.Meta.Pristine {
+		state = "already patched"
+	}
+	return fmt.Sprintf("Slack %s, %s", b.Meta.SlackVersion, state)
+}
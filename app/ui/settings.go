@@ -1,13 +1,25 @@
 package ui
 
 import (
+	"fmt"
 	"snail-installer/logic"
+	"strconv"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
+	"github.com/ncruces/zenity"
 )
 
+func saveSettings() {
+	err := logic.SaveSettings()
+	if err != nil {
+		println("Could not save settings:", err)
+	}
+}
+
 func NewSettingsPage(win fyne.Window) fyne.CanvasObject {
 	serverURLEntry := widget.NewEntry()
 	serverURLEntry.SetText(logic.AppSettings.ServerURL)
@@ -15,14 +27,91 @@ func NewSettingsPage(win fyne.Window) fyne.CanvasObject {
 
 	serverURLEntry.OnChanged = func(s string) {
 		logic.AppSettings.ServerURL = s
-		err := logic.SaveSettings()
+		saveSettings()
+	}
+
+	userAgentEntry := widget.NewEntry()
+	userAgentEntry.SetText(logic.AppSettings.UserAgent)
+	userAgentEntry.SetPlaceHolder("snail-installer")
+
+	userAgentEntry.OnChanged = func(s string) {
+		logic.AppSettings.UserAgent = strings.TrimSpace(s)
+		saveSettings()
+	}
+
+	// one PEM file per line
+	caEntry := widget.NewMultiLineEntry()
+	caEntry.SetText(strings.Join(logic.AppSettings.CABundles, "\n"))
+	caEntry.SetPlaceHolder("/path/to/corporate-ca.pem")
+	caEntry.SetMinRowsVisible(3)
+
+	caEntry.OnChanged = func(s string) {
+		var paths []string
+		for _, line := range strings.Split(s, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				paths = append(paths, line)
+			}
+		}
+		logic.AppSettings.CABundles = paths
+		saveSettings()
+	}
+
+	addCABtn := widget.NewButton("Add CA bundle", func() {
+		path, err := zenity.SelectFile(zenity.FileFilter{Name: "PEM certificates", Patterns: []string{"*.pem", "*.crt"}})
 		if err != nil {
-			println("Could not save settings:", err)
+			return
 		}
+		text := strings.TrimRight(caEntry.Text, "\n")
+		if text != "" {
+			text += "\n"
+		}
+		caEntry.SetText(text + path)
+	})
+
+	keepBackupsEntry := widget.NewEntry()
+	keepBackupsEntry.SetPlaceHolder("5")
+	if logic.AppSettings.KeepBackups > 0 {
+		keepBackupsEntry.SetText(strconv.Itoa(logic.AppSettings.KeepBackups))
 	}
 
+	keepBackupsEntry.OnChanged = func(s string) {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			// empty or garbage means the default
+			n = 0
+		}
+		logic.AppSettings.KeepBackups = n
+		saveSettings()
+	}
+
+	clearCacheBtn := widget.NewButton("Clear cache", func() {
+		size, _ := logic.CacheSize()
+		dialog.ShowConfirm("Clear cache",
+			fmt.Sprintf("Delete %.1f MB of downloaded assets in ~/.snail/cache? The next install downloads them again.", float64(size)/(1<<20)),
+			func(confirmed bool) {
+				if !confirmed {
+					return
+				}
+				if err := logic.ClearCache(); err != nil {
+					dialog.ShowError(err, win)
+					return
+				}
+				dialog.ShowInformation("Cache cleared", "Downloaded assets were deleted.", win)
+			}, win)
+	})
+
 	return container.NewVBox(
 		widget.NewLabel("Server URL:"),
 		serverURLEntry,
+		widget.NewLabel("User-Agent:"),
+		userAgentEntry,
+		widget.NewLabel("Extra CA bundles (proxies come from HTTPS_PROXY):"),
+		caEntry,
+		addCABtn,
+		widget.NewSeparator(),
+		widget.NewLabel("Backups to keep (the newest untouched one of every Slack version always stays):"),
+		keepBackupsEntry,
+		widget.NewSeparator(),
+		clearCacheBtn,
 	)
 }
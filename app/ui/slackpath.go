@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"fmt"
+	"snail-installer/logic"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ncruces/zenity"
+)
+
+// newSlackPathRow returns an entry pre-filled with the Slack installs we could
+// find (still editable), a button to pick one by hand, and a line describing
+// the selected install
+func newSlackPathRow() (*widget.SelectEntry, fyne.CanvasObject) {
+	installs := logic.DiscoverSlackInstalls()
+
+	var options []string
+	for _, install := range installs {
+		options = append(options, install.Path)
+	}
+
+	pathEntry := widget.NewSelectEntry(options)
+	pathEntry.SetPlaceHolder("/Applications/Slack.app/")
+
+	infoLabel := widget.NewLabel("")
+	infoLabel.Wrapping = fyne.TextWrapWord
+
+	pathEntry.OnChanged = func(s string) {
+		infoLabel.SetText("")
+		for _, install := range installs {
+			if install.Path == s {
+				infoLabel.SetText(fmt.Sprintf("Slack %s (%s install)", install.Version, install.Type))
+			}
+		}
+	}
+
+	if len(installs) > 0 {
+		pathEntry.SetText(installs[0].Path)
+	} else {
+		infoLabel.SetText("No Slack install found, please select it by hand.")
+	}
+
+	selectFileBtn := widget.NewButton("Select File", func() {
+		path, err := zenity.SelectFile()
+		if err == nil {
+			pathEntry.SetText(path)
+		}
+	})
+
+	// Row: entry expands, button stays fixed
+	row := container.NewBorder(
+		nil,           // top
+		nil,           // bottom
+		nil,           // left
+		selectFileBtn, // right
+		pathEntry,     // center expands
+	)
+
+	return pathEntry, container.NewVBox(row, infoLabel)
+}
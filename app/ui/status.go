@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"fmt"
+	"snail-installer/logic"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+var fixLabels = map[logic.Fix]string{
+	logic.FixInstall:  "Install snail",
+	logic.FixLoader:   "Download loader",
+	logic.FixCodeSign: "Sign Slack again",
+}
+
+func NewStatusPage(win fyne.Window) fyne.CanvasObject {
+
+	pathEntry, pathRow := newSlackPathRow()
+
+	reportLabel := widget.NewLabel("Press Check to see how snail is doing.")
+	reportLabel.Wrapping = fyne.TextWrapWord
+	problemsBox := container.NewVBox()
+
+	var checkBtn *widget.Button
+	var check func()
+
+	// fixes and checks both hit the disk and the network, keep them off the ui goroutine
+	runInBackground := func(fn func()) {
+		checkBtn.Disable()
+		go func() {
+			fn()
+			fyne.Do(checkBtn.Enable)
+		}()
+	}
+
+	showReport := func(report *logic.StatusReport) {
+		reportLabel.SetText(formatReport(report))
+		problemsBox.RemoveAll()
+
+		if report.Healthy() {
+			problemsBox.Add(widget.NewLabel("Everything looks fine \\o/"))
+			return
+		}
+
+		fixes := map[logic.Fix]bool{}
+		for _, problem := range report.Problems {
+			label := widget.NewLabel("• " + problem.Message)
+			label.Wrapping = fyne.TextWrapWord
+			if problem.Fix == "" || fixes[problem.Fix] {
+				// one button per fix is enough
+				problemsBox.Add(label)
+				continue
+			}
+			fixes[problem.Fix] = true
+
+			fix := problem.Fix
+			fixBtn := widget.NewButton(fixLabels[fix], func() {
+				runInBackground(func() {
+					err := logic.ApplyFix(report.SlackPath, fix)
+					fyne.Do(func() {
+						if err != nil {
+							dialog.ShowError(err, win)
+							return
+						}
+						check()
+					})
+				})
+			})
+			problemsBox.Add(container.NewBorder(nil, nil, nil, fixBtn, label))
+		}
+	}
+
+	check = func() {
+		if pathEntry.Text == "" {
+			dialog.ShowInformation("Info", "Please select the slack app \\o/", win)
+			return
+		}
+
+		path := pathEntry.Text
+		reportLabel.SetText("Checking...")
+		problemsBox.RemoveAll()
+		runInBackground(func() {
+			report, err := logic.Status(path)
+			fyne.Do(func() {
+				if err != nil {
+					reportLabel.SetText("")
+					dialog.ShowError(err, win)
+					return
+				}
+				showReport(report)
+			})
+		})
+	}
+
+	checkBtn = widget.NewButton("Check", check)
+
+	return container.NewVBox(
+		container.NewPadded(
+			container.NewVBox(
+				widget.NewLabel("Slack app path:"),
+				pathRow,
+				checkBtn,
+				reportLabel,
+				problemsBox,
+			),
+		),
+	)
+}
+
+func formatReport(report *logic.StatusReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Slack %s: snail %s\n", report.SlackVersion, report.Summary())
+	if report.CodeSignatureValid != nil {
+		if *report.CodeSignatureValid {
+			b.WriteString("Code signature: valid\n")
+		} else {
+			b.WriteString("Code signature: broken\n")
+		}
+	}
+	for _, file := range report.Loader {
+		state := "missing"
+		if file.Exists {
+			state = "ok"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", file.Name, state)
+	}
+	if report.ServerVersion != "" {
+		fmt.Fprintf(&b, "Loader %s, server has %s\n", report.LoaderVersion, report.ServerVersion)
+	}
+	fmt.Fprintf(&b, "%d plugins and %d themes enabled\n", report.PluginsEnabled, report.ThemesEnabled)
+	if state, ok := report.Fuses["EnableEmbeddedAsarIntegrityValidation"]; ok {
+		fmt.Fprintf(&b, "Asar integrity validation: %s", state)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
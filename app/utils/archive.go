@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// layeh.com/asar refuses headers with keys it doesn't know about (integrity,
+// link, ...), and every recent Slack asar has them, so reading goes through
+// this small decoder instead.
+
+var ErrMalformedAsar = errors.New("asar: malformed archive")
+
+// hard limit on the json header, real slack headers are a few hundred KB
+const maxAsarHeaderSize = 64 << 20
+
+type AsarIntegrity struct {
+	Algorithm string   `json:"algorithm"`
+	Hash      string   `json:"hash"`
+	BlockSize int      `json:"blockSize"`
+	Blocks    []string `json:"blocks"`
+}
+
+type AsarEntry struct {
+	Name       string
+	Parent     *AsarEntry
+	Children   []*AsarEntry
+	IsDir      bool
+	Size       int64
+	Offset     int64
+	Unpacked   bool
+	Executable bool
+	Link       string
+	Integrity  *AsarIntegrity
+}
+
+type AsarArchive struct {
+	Path       string
+	Root       *AsarEntry
+	Header     []byte // the raw json header string
+	DataOffset int64  // where file contents start
+
+	f *os.File
+}
+
+func OpenAsar(path string) (*AsarArchive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	header, dataOffset, err := readAsarHeader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	root, err := decodeAsarHeader(header)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &AsarArchive{
+		Path:       path,
+		Root:       root,
+		Header:     header,
+		DataOffset: dataOffset,
+		f:          f,
+	}, nil
+}
+
+func (a *AsarArchive) Close() error {
+	return a.f.Close()
+}
+
+// Find looks up a slash separated path inside the archive
+func (a *AsarArchive) Find(path string) *AsarEntry {
+	return a.Root.Find(path)
+}
+
+// Open returns a reader over the contents of a packed file
+func (a *AsarArchive) Open(e *AsarEntry) (*io.SectionReader, error) {
+	if e.IsDir || e.Link != "" {
+		return nil, fmt.Errorf("%s is not a regular file", e.Path())
+	}
+	if e.Unpacked {
+		return nil, fmt.Errorf("%s is stored in app.asar.unpacked", e.Path())
+	}
+	return io.NewSectionReader(a.f, a.DataOffset+e.Offset, e.Size), nil
+}
+
+func (a *AsarArchive) ReadFile(path string) ([]byte, error) {
+	e := a.Find(path)
+	if e == nil {
+		return nil, fmt.Errorf("%s not found in %s", path, a.Path)
+	}
+	r, err := a.Open(e)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func (e *AsarEntry) Find(path string) *AsarEntry {
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		var next *AsarEntry
+		for _, child := range e.Children {
+			if child.Name == name {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		e = next
+	}
+	return e
+}
+
+func (e *AsarEntry) Path() string {
+	var parts []string
+	for ; e != nil && e.Parent != nil; e = e.Parent {
+		parts = append([]string{e.Name}, parts...)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Walk calls fn for every entry below e, parents before children
+func (e *AsarEntry) Walk(fn func(path string, entry *AsarEntry) error) error {
+	return walkAsarEntry(e, "", fn)
+}
+
+func walkAsarEntry(e *AsarEntry, prefix string, fn func(string, *AsarEntry) error) error {
+	for _, child := range e.Children {
+		childPath := prefix + child.Name
+		if err := fn(childPath, child); err != nil {
+			return err
+		}
+		if child.IsDir {
+			if err := walkAsarEntry(child, childPath+"/", fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// the file starts with two chromium pickles: the first holds the size of the
+// second, the second holds the json header as a length prefixed string
+func readAsarHeader(r io.ReaderAt, fileSize int64) ([]byte, int64, error) {
+	var buf [16]byte
+	if n, _ := r.ReadAt(buf[:], 0); n != 16 {
+		return nil, 0, ErrMalformedAsar
+	}
+
+	if binary.LittleEndian.Uint32(buf[0:4]) != 4 {
+		return nil, 0, ErrMalformedAsar
+	}
+	headerPickleSize := int64(binary.LittleEndian.Uint32(buf[4:8]))
+	headerPayloadSize := int64(binary.LittleEndian.Uint32(buf[8:12]))
+	headerStringSize := int64(binary.LittleEndian.Uint32(buf[12:16]))
+
+	if headerPayloadSize != headerPickleSize-4 ||
+		headerStringSize > headerPayloadSize-4 ||
+		headerStringSize > maxAsarHeaderSize ||
+		8+headerPickleSize > fileSize {
+		return nil, 0, ErrMalformedAsar
+	}
+
+	header := make([]byte, headerStringSize)
+	if _, err := r.ReadAt(header, 16); err != nil {
+		return nil, 0, ErrMalformedAsar
+	}
+
+	return header, 8 + headerPickleSize, nil
+}
+
+func decodeAsarHeader(header []byte) (*AsarEntry, error) {
+	d := json.NewDecoder(bytes.NewReader(header))
+	d.UseNumber()
+
+	root := &AsarEntry{IsDir: true}
+	if err := decodeAsarEntry(d, root, 0); err != nil {
+		return nil, err
+	}
+	if !root.IsDir {
+		return nil, ErrMalformedAsar
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, ErrMalformedAsar
+	}
+	return root, nil
+}
+
+const maxAsarDepth = 256
+
+func decodeAsarEntry(d *json.Decoder, e *AsarEntry, depth int) error {
+	if depth > maxAsarDepth {
+		return ErrMalformedAsar
+	}
+	if err := expectDelim(d, '{'); err != nil {
+		return err
+	}
+
+	for d.More() {
+		key, err := expectString(d)
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case "files":
+			e.IsDir = true
+			if err := expectDelim(d, '{'); err != nil {
+				return err
+			}
+			seen := map[string]bool{}
+			for d.More() {
+				name, err := expectString(d)
+				if err != nil {
+					return err
+				}
+				if !validAsarName(name) {
+					return fmt.Errorf("%w: invalid file name %q", ErrMalformedAsar, name)
+				}
+				if seen[name] {
+					return fmt.Errorf("%w: %q is in the same folder twice", ErrMalformedAsar, name)
+				}
+				seen[name] = true
+				child := &AsarEntry{Name: name, Parent: e}
+				if err := decodeAsarEntry(d, child, depth+1); err != nil {
+					return err
+				}
+				e.Children = append(e.Children, child)
+			}
+			if err := expectDelim(d, '}'); err != nil {
+				return err
+			}
+		case "size":
+			e.Size, err = expectInt(d)
+		case "offset":
+			e.Offset, err = expectInt(d)
+		case "unpacked":
+			err = d.Decode(&e.Unpacked)
+		case "executable":
+			err = d.Decode(&e.Executable)
+		case "link":
+			err = d.Decode(&e.Link)
+		case "integrity":
+			err = d.Decode(&e.Integrity)
+		default:
+			// unknown keys are kept out of the model but shouldn't break reading
+			var skip json.RawMessage
+			err = d.Decode(&skip)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformedAsar, err)
+		}
+	}
+
+	// both positive, a sum that overflows goes negative
+	if e.Size < 0 || e.Offset < 0 || e.Offset+e.Size < 0 {
+		return ErrMalformedAsar
+	}
+
+	return expectDelim(d, '}')
+}
+
+func expectDelim(d *json.Decoder, delim json.Delim) error {
+	tok, err := d.Token()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedAsar, err)
+	}
+	if got, ok := tok.(json.Delim); !ok || got != delim {
+		return ErrMalformedAsar
+	}
+	return nil
+}
+
+func expectString(d *json.Decoder) (string, error) {
+	tok, err := d.Token()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformedAsar, err)
+	}
+	s, ok := tok.(string)
+	if !ok {
+		return "", ErrMalformedAsar
+	}
+	return s, nil
+}
+
+// sizes are json numbers, offsets are strings (so they survive >2^53)
+func expectInt(d *json.Decoder) (int64, error) {
+	tok, err := d.Token()
+	if err != nil {
+		return 0, err
+	}
+	switch v := tok.(type) {
+	case json.Number:
+		return v.Int64()
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, ErrMalformedAsar
+}
+
+func validAsarName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, "\x00/\\")
+}
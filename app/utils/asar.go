@@ -1,120 +1,552 @@
 package utils
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
-
-	"layeh.com/asar"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-func PackFolderToAsar(srcDir string, asarPath string) error {
-	outFile, err := os.Create(asarPath)
+// electron can't address more than this in a single file
+const maxAsarFileSize = 1<<32 - 1
+
+type PackOptions struct {
+	// slash separated paths (relative to the packed folder) that go to
+	// <asar>.unpacked instead of the archive, a directory takes everything below it
+	Unpack []string
+	// path.Match patterns, files whose path or name matches one go to
+	// <asar>.unpacked too, like asar's --unpack
+	UnpackGlobs []string
+	// when set, exactly these paths (same rules as Unpack) are executable and
+	// the file modes don't matter. windows has no executable bit, this is the
+	// only way to get the same archive there
+	Executable []string
+}
+
+// PackFolderToAsar packs srcDir into an archive. the same files with the same
+// contents and options always give the same bytes: entries are sorted by
+// name and nothing but the executable flag is taken from the file modes
+func PackFolderToAsar(srcDir string, asarPath string, opts PackOptions) error {
+	srcDir, err := filepath.Abs(srcDir)
 	if err != nil {
-		return fmt.Errorf("failed to create ASAR file: %w", err)
+		return err
 	}
-	defer outFile.Close()
 
-	rootEntry := asar.New("root", nil, 0, 0, asar.FlagDir)
+	unpack := map[string]bool{}
+	for _, p := range opts.Unpack {
+		unpack[path.Clean(p)] = true
+	}
+	for _, pattern := range opts.UnpackGlobs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid unpack pattern %q: %w", pattern, err)
+		}
+	}
+	unpackGlob := func(relPath string) bool {
+		for _, pattern := range opts.UnpackGlobs {
+			if ok, _ := path.Match(pattern, relPath); ok {
+				return true
+			}
+			if ok, _ := path.Match(pattern, path.Base(relPath)); ok {
+				return true
+			}
+		}
+		return false
+	}
 
-	currentEntryMap := map[string]*asar.Entry{
-		srcDir: rootEntry,
+	var executable map[string]bool
+	if opts.Executable != nil {
+		executable = map[string]bool{}
+		for _, p := range opts.Executable {
+			executable[path.Clean(p)] = true
+		}
+	}
+	isExecutable := func(relPath string, mode os.FileMode) bool {
+		if executable == nil {
+			// the owner's executable bit, like @electron/asar. windows has
+			// none, so never set it from there
+			return runtime.GOOS != "windows" && mode&0100 != 0
+		}
+		for p := relPath; p != "."; p = path.Dir(p) {
+			if executable[p] {
+				return true
+			}
+		}
+		return false
 	}
 
-	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+	root := &AsarEntry{IsDir: true}
+
+	// files whose contents go in the archive, in header order
+	var packed []*AsarEntry
+	sources := map[*AsarEntry]string{}
+	var offset int64
+
+	var walk func(dir, rel string, parent *AsarEntry) error
+	walk = func(dir, rel string, parent *AsarEntry) error {
+		children, err := os.ReadDir(dir)
 		if err != nil {
 			return err
 		}
+		// byte order, whatever the file system lists first
+		sort.Slice(children, func(i, j int) bool { return children[i].Name() < children[j].Name() })
+
+		for _, child := range children {
+			p := filepath.Join(dir, child.Name())
+			relPath := path.Join(rel, child.Name())
+
+			info, err := child.Info()
+			if err != nil {
+				return err
+			}
+
+			entry := &AsarEntry{
+				Name:     child.Name(),
+				Parent:   parent,
+				Unpacked: parent.Unpacked || unpack[relPath],
+			}
+			parent.Children = append(parent.Children, entry)
+
+			switch {
+			case info.IsDir():
+				entry.IsDir = true
+				if err := walk(p, relPath, entry); err != nil {
+					return err
+				}
+
+			case info.Mode()&os.ModeSymlink != 0:
+				link, err := resolvePackLink(srcDir, p)
+				if err != nil {
+					return err
+				}
+				entry.Link = link
+
+			case info.Mode().IsRegular():
+				if info.Size() > maxAsarFileSize {
+					return fmt.Errorf("%s: file is larger than 4GB", p)
+				}
+				entry.Size = info.Size()
+				entry.Unpacked = entry.Unpacked || unpackGlob(relPath)
+				entry.Executable = isExecutable(relPath, info.Mode())
+				sources[entry] = p
+
+				entry.Integrity, err = hashFile(p)
+				if err != nil {
+					return err
+				}
+
+				if entry.Unpacked {
+					continue
+				}
+
+				entry.Offset = offset
+				offset += entry.Size
+				packed = append(packed, entry)
+
+			default:
+				return fmt.Errorf("%s: unsupported file type %s", p, info.Mode().Type())
+			}
+		}
+		return nil
+	}
+
+	if err := walk(srcDir, "", root); err != nil {
+		return fmt.Errorf("error walking directory %s: %w", srcDir, err)
+	}
+
+	outFile, err := os.Create(asarPath)
+	if err != nil {
+		return fmt.Errorf("failed to create ASAR file: %w", err)
+	}
+	defer outFile.Close()
+
+	_, err = outFile.Write(EncodeAsarHeader(root))
+	if err != nil {
+		return fmt.Errorf("failed to write ASAR header: %w", err)
+	}
 
-		relPath, err := filepath.Rel(srcDir, path)
+	// one file open at a time
+	for _, entry := range packed {
+		err = appendFile(outFile, sources[entry], entry.Size)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to pack %s: %w", entry.Path(), err)
 		}
+	}
 
-		if relPath == "." {
+	err = writeUnpackedFiles(root, sources, asarPath+".unpacked")
+	if err != nil {
+		return err
+	}
+
+	return outFile.Close()
+}
+
+func hashFile(p string) (*AsarIntegrity, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return FileIntegrity(f)
+}
+
+func appendFile(w io.Writer, src string, size int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(w, io.LimitReader(f, size))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("file changed size while packing")
+	}
+	return nil
+}
+
+// symlinks are stored relative to the archive root and may not leave it
+func resolvePackLink(srcDir, p string) (string, error) {
+	target, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", p, err)
+	}
+	realSrc, err := filepath.EvalSymlinks(srcDir)
+	if err != nil {
+		return "", err
+	}
+
+	link, err := filepath.Rel(realSrc, target)
+	if err != nil {
+		return "", err
+	}
+	link = filepath.ToSlash(link)
+	if link == ".." || strings.HasPrefix(link, "../") {
+		return "", fmt.Errorf("%s: links out of the package", p)
+	}
+	return link, nil
+}
+
+func writeUnpackedFiles(root *AsarEntry, sources map[*AsarEntry]string, unpackedDir string) error {
+	return root.Walk(func(p string, e *AsarEntry) error {
+		if !e.Unpacked {
 			return nil
 		}
 
-		parentPath := filepath.Dir(path)
-		parentEntry, ok := currentEntryMap[parentPath]
-		if !ok {
-			return fmt.Errorf("internal error: could not find parent entry for %s", path)
+		dest := filepath.Join(unpackedDir, filepath.FromSlash(p))
+
+		switch {
+		case e.IsDir:
+			return os.MkdirAll(dest, 0755)
+		case e.Link != "":
+			return writeLink(unpackedDir, p, e.Link)
+		default:
+			err := os.MkdirAll(filepath.Dir(dest), 0755)
+			if err != nil {
+				return err
+			}
+			var mode os.FileMode = 0644
+			if e.Executable {
+				mode = 0755
+			}
+			err = copyFileTo(sources[e], dest, mode)
+			if err == nil {
+				// an existing file keeps its mode through OpenFile
+				err = os.Chmod(dest, mode)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to copy unpacked file %s: %w", p, err)
+			}
+			return nil
 		}
+	})
+}
 
-		entryName := info.Name()
-		var newEntry *asar.Entry
+// UnpackAsarToFolder extracts an archive into destDir. nothing gets written
+// outside of it: paths that would leave it, links that point out of the
+// archive and existing symlinks on the way are refused
+func UnpackAsarToFolder(asarPath string, destDir string) error {
+	archive, err := OpenAsar(asarPath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
 
-		if info.IsDir() {
-			newEntry = asar.New(entryName, nil, 0, 0, asar.FlagDir)
-			parentEntry.Children = append(parentEntry.Children, newEntry)
-			currentEntryMap[path] = newEntry
+	unpackedDir := asarPath + ".unpacked"
 
-		} else {
-			file, err := os.Open(path)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	realDest, err := filepath.EvalSymlinks(destDir)
+	if err != nil {
+		return err
+	}
+
+	// links go last, so nothing else can be written through one of them
+	var links []*AsarEntry
+	// folders already known to be inside destDir
+	inside := map[string]bool{}
+
+	err = archive.Root.Walk(func(p string, e *AsarEntry) error {
+		if !filepath.IsLocal(filepath.FromSlash(p)) {
+			return fmt.Errorf("%w: unsafe path %q", ErrMalformedAsar, p)
+		}
+		fullPath := filepath.Join(destDir, filepath.FromSlash(p))
+
+		if e.Link != "" {
+			if !linkInside(e.Link) {
+				return fmt.Errorf("%w: %s links to %s, outside the archive", ErrMalformedAsar, p, e.Link)
+			}
+			links = append(links, e)
+			return nil
+		}
+
+		if e.IsDir {
+			if err := os.MkdirAll(fullPath, 0755); err != nil {
+				return err
+			}
+			return checkInside(realDest, fullPath, inside)
+		}
+		if err := checkInside(realDest, filepath.Dir(fullPath), inside); err != nil {
+			return err
+		}
+		// a symlink already sitting there would be written through
+		if info, err := os.Lstat(fullPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(fullPath); err != nil {
+				return err
+			}
+		}
+
+		if e.Unpacked {
+			// the contents live next to the archive
+			src := filepath.Join(unpackedDir, filepath.FromSlash(p))
+			info, err := os.Stat(src)
 			if err != nil {
-				return fmt.Errorf("failed to open file %s: %w", path, err)
+				return fmt.Errorf("unpacked file %s is missing: %w", p, err)
 			}
-			defer file.Close()
+			return copyFileTo(src, fullPath, info.Mode().Perm())
+		}
 
-			newEntry = asar.New(
-				entryName,
-				file,
-				info.Size(),
-				0,
-				asar.FlagNone,
-			)
+		r, err := archive.Open(e)
+		if err != nil {
+			return err
+		}
 
-			parentEntry.Children = append(parentEntry.Children, newEntry)
+		var mode os.FileMode = 0644
+		if e.Executable {
+			mode = 0755
 		}
 
-		return nil
+		out, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(out, r)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil && n != e.Size {
+			err = fmt.Errorf("%w: %s is cut off", ErrMalformedAsar, p)
+		}
+		return err
 	})
+	if err != nil {
+		return err
+	}
 
+	for _, e := range links {
+		if err := writeLink(destDir, e.Path(), e.Link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkInside is true for link targets (relative to the archive root) that
+// stay in the archive
+func linkInside(link string) bool {
+	return !path.IsAbs(link) && filepath.IsLocal(filepath.FromSlash(link))
+}
+
+// checkInside makes sure dir, with symlinks resolved, is still in realDest
+func checkInside(realDest, dir string, inside map[string]bool) error {
+	if inside[dir] {
+		return nil
+	}
+	real, err := filepath.EvalSymlinks(dir)
 	if err != nil {
-		return fmt.Errorf("error walking directory %s: %w", srcDir, err)
+		return err
 	}
+	rel, err := filepath.Rel(realDest, real)
+	if err != nil || !(rel == "." || filepath.IsLocal(rel)) {
+		return fmt.Errorf("%s leads outside of %s", dir, realDest)
+	}
+	inside[dir] = true
+	return nil
+}
 
-	_, err = rootEntry.EncodeTo(outFile)
+// writeLink creates the symlink p -> link (both relative to the archive
+// root) inside destDir, pointing relative to p's own folder like asar does
+func writeLink(destDir, p, link string) error {
+	fullPath := filepath.Join(destDir, filepath.FromSlash(p))
+
+	target, err := filepath.Rel(filepath.FromSlash(path.Dir(p)), filepath.FromSlash(link))
 	if err != nil {
-		return fmt.Errorf("failed to encode ASAR archive: %w", err)
+		return err
 	}
 
-	return nil
+	err = os.MkdirAll(filepath.Dir(fullPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	// can't overwrite an existing link
+	os.Remove(fullPath)
+	return os.Symlink(target, fullPath)
 }
 
-func UnpackAsarToFolder(asarPath string, destDir string) error {
-	f, err := os.Open(asarPath)
+func copyFileTo(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer in.Close()
 
-	root, err := asar.Decode(f)
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return err
 	}
 
-	return root.Walk(func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
 
-		fullPath := filepath.Join(destDir, path)
+// UnpackedPaths returns the top-most entries stored in <asar>.unpacked, so
+// PackOptions{Unpack: a.UnpackedPaths()} repacks with the same layout
+func (a *AsarArchive) UnpackedPaths() []string {
+	var paths []string
+	a.Root.Walk(func(p string, e *AsarEntry) error {
+		if e.Unpacked && !e.Parent.Unpacked {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	return paths
+}
 
-		if info.IsDir() {
-			return os.MkdirAll(fullPath, info.Mode())
-		} else {
-			entry := root.Find(path)
-			if entry == nil {
-				return nil
+// ExecutablePaths returns every file marked executable, so
+// PackOptions{Executable: a.ExecutablePaths()} repacks with the same flags
+// on any system. unpacked files count when their copy is executable
+func (a *AsarArchive) ExecutablePaths() []string {
+	paths := []string{}
+	a.Root.Walk(func(p string, e *AsarEntry) error {
+		if e.IsDir || e.Link != "" {
+			return nil
+		}
+		if e.Unpacked {
+			info, err := os.Stat(filepath.Join(a.Path+".unpacked", filepath.FromSlash(p)))
+			if err == nil && info.Mode()&0111 != 0 {
+				paths = append(paths, p)
 			}
+		} else if e.Executable {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	return paths
+}
+
+// EncodeAsarHeader returns everything that comes before the file contents:
+// the size pickle, then the header pickle holding the json string
+func EncodeAsarHeader(root *AsarEntry) []byte {
+	header := encodeAsarHeaderJSON(root)
+
+	// pickle strings are padded to 4 bytes
+	padding := (4 - len(header)%4) % 4
+	headerPickleSize := 4 + 4 + len(header) + padding
+
+	out := make([]byte, 8+headerPickleSize)
+	binary.LittleEndian.PutUint32(out[0:4], 4)
+	binary.LittleEndian.PutUint32(out[4:8], uint32(headerPickleSize))
+	binary.LittleEndian.PutUint32(out[8:12], uint32(headerPickleSize-4))
+	binary.LittleEndian.PutUint32(out[12:16], uint32(len(header)))
+	copy(out[16:], header)
+
+	return out
+}
+
+// keys are written in the same order @electron/asar uses
+func encodeAsarHeaderJSON(root *AsarEntry) []byte {
+	var buf bytes.Buffer
+	writeAsarEntryJSON(&buf, root)
+	return buf.Bytes()
+}
+
+func writeAsarEntryJSON(buf *bytes.Buffer, e *AsarEntry) {
+	buf.WriteByte('{')
 
-			data := entry.Bytes()
-			if data == nil {
-				return nil
+	switch {
+	case e.IsDir:
+		if e.Unpacked {
+			buf.WriteString(`"unpacked":true,`)
+		}
+		buf.WriteString(`"files":{`)
+		for i, child := range e.Children {
+			if i > 0 {
+				buf.WriteByte(',')
 			}
+			writeJSONString(buf, child.Name)
+			buf.WriteByte(':')
+			writeAsarEntryJSON(buf, child)
+		}
+		buf.WriteByte('}')
 
-			return os.WriteFile(fullPath, data, info.Mode())
+	case e.Link != "":
+		if e.Unpacked {
+			buf.WriteString(`"unpacked":true,`)
 		}
-	})
+		buf.WriteString(`"link":`)
+		writeJSONString(buf, e.Link)
+
+	default:
+		buf.WriteString(`"size":`)
+		buf.WriteString(strconv.FormatInt(e.Size, 10))
+		if e.Unpacked {
+			buf.WriteString(`,"unpacked":true`)
+		} else {
+			buf.WriteString(`,"offset":"`)
+			buf.WriteString(strconv.FormatInt(e.Offset, 10))
+			buf.WriteByte('"')
+		}
+		if e.Integrity != nil {
+			buf.WriteString(`,"integrity":`)
+			integrity, _ := json.Marshal(e.Integrity)
+			buf.Write(integrity)
+		}
+		if e.Executable && !e.Unpacked {
+			buf.WriteString(`,"executable":true`)
+		}
+	}
+
+	buf.WriteByte('}')
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	// same escaping as JSON.stringify, go would turn < > & into \u escapes
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // trailing newline
 }
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenTree is packed by TestPackGolden, with the unpack and executable
+// options below. testdata/golden.asar is what it has to come out as
+var goldenTree = map[string]string{
+	"package.json":                  `{"name":"golden","main":"index.js"}`,
+	"index.js":                      "require('./lib/a.js');\n",
+	"lib/a.js":                      "module.exports = 'a';\n",
+	"lib/b.js":                      "module.exports = 'b';\n",
+	"lib/Z.js":                      "uppercase sorts first\n",
+	"bin/run.sh":                    "#!/bin/sh\necho run\n",
+	"native/addon.node":             "not really native\n",
+	"assets/icon.png":               "png",
+	"node_modules/foo/package.json": `{"name":"foo"}`,
+}
+
+var goldenOptions = PackOptions{
+	Unpack:      []string{"native"},
+	UnpackGlobs: []string{"*.png"},
+	Executable:  []string{"bin/run.sh"},
+}
+
+// the same tree packs to the same bytes whatever order it was written in,
+// with whatever modes and times, on any os
+func TestPackGolden(t *testing.T) {
+	golden := filepath.Join("testdata", "golden.asar")
+
+	var got []byte
+	for i, order := range [][]string{sortedKeys(goldenTree), reversedKeys(goldenTree)} {
+		src := filepath.Join(t.TempDir(), "app")
+		for j, name := range order {
+			writeTree(t, src, map[string]string{name: goldenTree[name]})
+			p := filepath.Join(src, filepath.FromSlash(name))
+			// modes and times that differ between the two runs
+			if err := os.Chmod(p, []os.FileMode{0600, 0644, 0755}[(i+j)%3]); err != nil {
+				t.Fatal(err)
+			}
+			when := time.Unix(int64(1e9+i*1000+j), 0)
+			if err := os.Chtimes(p, when, when); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		asarPath := filepath.Join(t.TempDir(), "app.asar")
+		if err := PackFolderToAsar(src, asarPath, goldenOptions); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(asarPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil && !bytes.Equal(got, data) {
+			t.Fatal("packing the same tree twice gave different archives")
+		}
+		got = data
+	}
+
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("archive differs from %s, run go test -run PackGolden -update if that's on purpose", golden)
+	}
+}
+
+// without an Executable list only the owner's executable bit counts
+func TestPackExecutableBit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows has no executable bit")
+	}
+	src := filepath.Join(t.TempDir(), "app")
+	writeTree(t, src, map[string]string{"owner": "", "group": "", "other": "", "none": ""})
+	for name, mode := range map[string]os.FileMode{"owner": 0744, "group": 0654, "other": 0645, "none": 0644} {
+		if err := os.Chmod(filepath.Join(src, name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	asarPath := filepath.Join(t.TempDir(), "app.asar")
+	if err := PackFolderToAsar(src, asarPath, PackOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := OpenAsar(asarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	for name, want := range map[string]bool{"owner": true, "group": false, "other": false, "none": false} {
+		if got := a.Find(name).Executable; got != want {
+			t.Errorf("%s executable = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func reversedKeys(m map[string]string) []string {
+	keys := sortedKeys(m)
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+	return keys
+}
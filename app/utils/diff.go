@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// a small myers line diff, enough to see what a patch did to a js file
+// without installing anything
+
+const (
+	diffContext = 3
+	// slack's bundles are huge, past this many changed lines a diff is no help
+	maxDiffEdits = 2000
+	// minified lines go on forever, they get cut when printed
+	maxDiffLineLength = 300
+)
+
+type editKind int
+
+const (
+	editEqual editKind = iota
+	editDelete
+	editInsert
+)
+
+// lineEdit is one step of the script, a and b are the positions in each
+// side before it
+type lineEdit struct {
+	kind editKind
+	a, b int
+}
+
+// DiffText returns a unified diff of two text files, "" when they're the
+// same. ok is false when they differ too much to be worth showing
+func DiffText(oldName, newName string, oldData, newData []byte) (diff string, ok bool) {
+	if bytes.Equal(oldData, newData) {
+		return "", true
+	}
+	a, b := splitLines(oldData), splitLines(newData)
+	edits, ok := diffLines(a, b, maxDiffEdits)
+	if !ok {
+		return "", false
+	}
+	return unifiedDiff(oldName, newName, a, b, edits), true
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines is myers' O((n+m)d) algorithm, giving up after maxEdits
+func diffLines(a, b []string, maxEdits int) ([]lineEdit, bool) {
+	n, m := len(a), len(b)
+	if maxEdits > n+m {
+		maxEdits = n + m
+	}
+
+	// v[k] is the furthest x reached on diagonal k, shifted by offset
+	offset := maxEdits + 1
+	v := make([]int, 2*maxEdits+3)
+	// v as it was before each round, only the part that round can look at
+	var trace [][]int
+
+	for d := 0; d <= maxEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, n, m), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func backtrack(trace [][]int, x, y int) []lineEdit {
+	var edits []lineEdit
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, lineEdit{editEqual, x, y})
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, lineEdit{editInsert, x, prevY})
+			} else {
+				edits = append(edits, lineEdit{editDelete, prevX, y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+func unifiedDiff(oldName, newName string, a, b []string, edits []lineEdit) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	for i := 0; i < len(edits); {
+		if edits[i].kind == editEqual {
+			i++
+			continue
+		}
+
+		// a hunk runs until there are more than 2*diffContext equal lines in a row
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].kind != editEqual {
+				end = j
+			} else if j-end > 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext+1, len(edits))
+
+		var aLen, bLen int
+		for _, e := range edits[start:end] {
+			if e.kind != editInsert {
+				aLen++
+			}
+			if e.kind != editDelete {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(edits[start].a, aLen), hunkRange(edits[start].b, bLen))
+
+		for _, e := range edits[start:end] {
+			switch e.kind {
+			case editEqual:
+				writeDiffLine(&out, ' ', a[e.a])
+			case editDelete:
+				writeDiffLine(&out, '-', a[e.a])
+			case editInsert:
+				writeDiffLine(&out, '+', b[e.b])
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+func writeDiffLine(out *strings.Builder, prefix byte, line string) {
+	out.WriteByte(prefix)
+	text := strings.TrimSuffix(line, "\n")
+	if len(text) > maxDiffLineLength {
+		text = fmt.Sprintf("%s... (%d more bytes)", text[:maxDiffLineLength], len(text)-maxDiffLineLength)
+	}
+	out.WriteString(text)
+	out.WriteByte('\n')
+	if !strings.HasSuffix(line, "\n") {
+		out.WriteString("\\ No newline at end of file\n")
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rawAsar wraps a json header the way asar does, with data after it
+func rawAsar(header string, data []byte) []byte {
+	padding := (4 - len(header)%4) % 4
+	pickleSize := 4 + 4 + len(header) + padding
+	out := make([]byte, 8+pickleSize, 8+pickleSize+len(data))
+	binary.LittleEndian.PutUint32(out[0:4], 4)
+	binary.LittleEndian.PutUint32(out[4:8], uint32(pickleSize))
+	binary.LittleEndian.PutUint32(out[8:12], uint32(pickleSize-4))
+	binary.LittleEndian.PutUint32(out[12:16], uint32(len(header)))
+	copy(out[16:], header)
+	return append(out, data...)
+}
+
+// headers that go after the things extraction has to refuse
+var fuzzHeaders = []string{
+	`{"files":{"index.js":{"size":5,"offset":"0"}}}`,
+	`{"files":{"a":{"files":{"b.js":{"size":2,"offset":"3","executable":true}}}}}`,
+	`{"files":{"..":{"files":{"evil.js":{"size":1,"offset":"0"}}}}}`,
+	`{"files":{"a/../../evil.js":{"size":1,"offset":"0"}}}`,
+	`{"files":{"/abs.js":{"size":1,"offset":"0"}}}`,
+	`{"files":{"out":{"link":"../../etc"}}}`,
+	`{"files":{"out":{"link":"/etc"}}}`,
+	`{"files":{"a":{"link":"b"},"b":{"files":{}},"c":{"link":"a"}}}`,
+	`{"files":{"dir":{"link":"."},"dir2":{"files":{"x.js":{"size":1,"offset":"0"}}}}}`,
+	`{"files":{"u.js":{"size":1,"unpacked":true}}}`,
+	`{"files":{"big.js":{"size":99999999,"offset":"0"}}}`,
+	`{"files":{"neg.js":{"size":-1,"offset":"-5"}}}`,
+	`{"files":{}}`,
+	`{}`,
+	`[]`,
+}
+
+func FuzzReadAsarHeader(f *testing.F) {
+	for _, h := range fuzzHeaders {
+		f.Add(rawAsar(h, []byte("hello")))
+	}
+	f.Add([]byte{})
+	f.Add([]byte{4, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, dataOffset, err := readAsarHeader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		if dataOffset > int64(len(data)) {
+			t.Fatalf("data starts at %d, past the end of %d bytes", dataOffset, len(data))
+		}
+		if len(header) > maxAsarHeaderSize || 16+int64(len(header)) > dataOffset {
+			t.Fatalf("%d byte header doesn't fit before offset %d", len(header), dataOffset)
+		}
+
+		root, err := decodeAsarHeader(header)
+		if err != nil {
+			return
+		}
+		// whatever decodes has to survive being written out and read again
+		again := EncodeAsarHeader(root)
+		header, _, err = readAsarHeader(bytes.NewReader(again), int64(len(again)))
+		if err != nil {
+			t.Fatalf("re-encoded header doesn't read: %s", err)
+		}
+		if _, err := decodeAsarHeader(header); err != nil {
+			t.Fatalf("re-encoded header doesn't decode: %s", err)
+		}
+	})
+}
+
+// whatever the archive says, extraction may only write under the folder
+// it was given, and every link it makes has to point inside it
+func FuzzUnpackAsar(f *testing.F) {
+	for _, h := range fuzzHeaders {
+		f.Add(h, []byte("hello world"))
+	}
+
+	f.Fuzz(func(t *testing.T, header string, data []byte) {
+		asarPath := filepath.Join(t.TempDir(), "app.asar")
+		if err := os.WriteFile(asarPath, rawAsar(header, data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		sandbox := t.TempDir()
+		dest := filepath.Join(sandbox, "out", "dest")
+		_ = UnpackAsarToFolder(asarPath, dest)
+
+		entries, err := os.ReadDir(sandbox)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if e.Name() != "out" {
+				t.Fatalf("wrote %s outside of the destination", e.Name())
+			}
+		}
+		if entries, _ := os.ReadDir(filepath.Join(sandbox, "out")); len(entries) > 1 {
+			t.Fatalf("wrote %d things next to the destination", len(entries)-1)
+		}
+
+		err = filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.Type()&fs.ModeSymlink == 0 {
+				return err
+			}
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if filepath.IsAbs(target) {
+				t.Errorf("%s links to absolute %s", p, target)
+				return nil
+			}
+			rel, err := filepath.Rel(dest, filepath.Join(filepath.Dir(p), target))
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				t.Errorf("%s links to %s, outside the destination", p, target)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree writes files (slash separated path -> contents) under dir
+func writeTree(t testing.TB, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// packTree packs files into <tmp>/app.asar and returns its path
+func packTree(t testing.TB, files map[string]string, opts PackOptions) string {
+	t.Helper()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app")
+	writeTree(t, src, files)
+	asarPath := filepath.Join(dir, "app.asar")
+	if err := PackFolderToAsar(src, asarPath, opts); err != nil {
+		t.Fatal(err)
+	}
+	return asarPath
+}
@@ -0,0 +1,338 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// what snail-installer asar ls/cat/diff/verify are built on
+
+// OpenFile opens a file's contents wherever they are, in the archive or in
+// <asar>.unpacked
+func (a *AsarArchive) OpenFile(e *AsarEntry) (io.ReadCloser, error) {
+	if e.Unpacked && !e.IsDir && e.Link == "" {
+		return os.Open(filepath.Join(a.Path+".unpacked", filepath.FromSlash(e.Path())))
+	}
+	r, err := a.Open(e)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(r), nil
+}
+
+// ReadAnyFile is ReadFile that also reads unpacked files
+func (a *AsarArchive) ReadAnyFile(path string) ([]byte, error) {
+	e := a.Find(path)
+	if e == nil {
+		return nil, fmt.Errorf("%s not found in %s", path, a.Path)
+	}
+	r, err := a.OpenFile(e)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// FileHash is the sha256 of a file, taken from the header when it has one
+func (a *AsarArchive) FileHash(e *AsarEntry) (string, error) {
+	if e.Integrity != nil && e.Integrity.Hash != "" && strings.EqualFold(e.Integrity.Algorithm, integrityAlgorithm) {
+		return e.Integrity.Hash, nil
+	}
+	r, err := a.OpenFile(e)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type AsarProblem struct {
+	Path    string `json:"path"` // empty for problems with the whole archive
+	Message string `json:"message"`
+}
+
+type VerifyOptions struct {
+	// the asar was copied without its .unpacked folder (backups are), its
+	// unpacked files aren't checked
+	SkipUnpacked bool
+}
+
+// VerifyAsar checks that an archive is sound: a header that decodes, every
+// file inside the archive (and not on top of another one), links that stay
+// inside, unpacked files that exist, and contents that match their
+// integrity hashes. it only returns an error when the file can't be read
+func VerifyAsar(asarPath string, opts VerifyOptions) ([]AsarProblem, error) {
+	info, err := os.Stat(asarPath)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := OpenAsar(asarPath)
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return nil, err
+		}
+		return []AsarProblem{{Message: "header: " + err.Error()}}, nil
+	}
+	defer a.Close()
+
+	var problems []AsarProblem
+	report := func(p, format string, args ...any) {
+		problems = append(problems, AsarProblem{Path: p, Message: fmt.Sprintf(format, args...)})
+	}
+
+	dataSize := info.Size() - a.DataOffset
+	var packed []*AsarEntry
+
+	err = a.Root.Walk(func(p string, e *AsarEntry) error {
+		switch {
+		case e.IsDir:
+			return nil
+		case e.Link != "":
+			// links are relative to the root of the archive, not to the link
+			if !linkInside(e.Link) {
+				report(p, "link to %s points outside the archive", e.Link)
+			} else if a.Find(e.Link) == nil {
+				report(p, "link to %s points at nothing", e.Link)
+			}
+			return nil
+		case e.Unpacked && opts.SkipUnpacked:
+			return nil
+		case e.Unpacked:
+			unpackedPath := filepath.Join(a.Path+".unpacked", filepath.FromSlash(p))
+			uinfo, err := os.Stat(unpackedPath)
+			if err != nil {
+				report(p, "missing from %s.unpacked", filepath.Base(a.Path))
+				return nil
+			}
+			if uinfo.Size() != e.Size {
+				report(p, "is %d bytes in %s.unpacked, the header says %d", uinfo.Size(), filepath.Base(a.Path), e.Size)
+				return nil
+			}
+		default:
+			if e.Offset+e.Size > dataSize {
+				report(p, "offset %d + size %d is past the end of the archive (%d bytes of data)", e.Offset, e.Size, dataSize)
+				return nil
+			}
+			packed = append(packed, e)
+		}
+
+		if e.Integrity == nil {
+			// older asars have no hashes at all
+			return nil
+		}
+		if msg := checkIntegrity(a, e); msg != "" {
+			report(p, "%s", msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(packed, func(i, j int) bool { return packed[i].Offset < packed[j].Offset })
+	for i := 1; i < len(packed); i++ {
+		prev, e := packed[i-1], packed[i]
+		if e.Size > 0 && prev.Offset+prev.Size > e.Offset {
+			report(e.Path(), "overlaps %s", prev.Path())
+		}
+	}
+
+	return problems, nil
+}
+
+// checkIntegrity hashes a file like FileIntegrity and says what doesn't
+// match, "" when it all does
+func checkIntegrity(a *AsarArchive, e *AsarEntry) string {
+	want := e.Integrity
+	if !strings.EqualFold(want.Algorithm, integrityAlgorithm) {
+		return fmt.Sprintf("unknown integrity algorithm %q", want.Algorithm)
+	}
+	if want.BlockSize <= 0 {
+		return fmt.Sprintf("invalid integrity block size %d", want.BlockSize)
+	}
+	if blocks := e.Size/int64(want.BlockSize) + 1; int64(len(want.Blocks)) != blocks {
+		return fmt.Sprintf("integrity has %d block hashes, a file of %d bytes has %d", len(want.Blocks), e.Size, blocks)
+	}
+
+	r, err := a.OpenFile(e)
+	if err != nil {
+		return err.Error()
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	block := make([]byte, want.BlockSize)
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(r, block)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err.Error()
+		}
+		h.Write(block[:n])
+		sum := sha256.Sum256(block[:n])
+		if i < len(want.Blocks) && hex.EncodeToString(sum[:]) != want.Blocks[i] {
+			return fmt.Sprintf("block %d does not match its integrity hash", i)
+		}
+		if n < want.BlockSize {
+			break
+		}
+	}
+	if hex.EncodeToString(h.Sum(nil)) != want.Hash {
+		return "contents do not match the integrity hash"
+	}
+	return ""
+}
+
+type AsarChangeKind string
+
+const (
+	AsarAdded   AsarChangeKind = "added"
+	AsarRemoved AsarChangeKind = "removed"
+	AsarChanged AsarChangeKind = "changed"
+)
+
+type AsarChange struct {
+	Path    string         `json:"path"`
+	Kind    AsarChangeKind `json:"kind"`
+	OldSize int64          `json:"oldSize,omitempty"`
+	NewSize int64          `json:"newSize,omitempty"`
+	OldHash string         `json:"oldHash,omitempty"`
+	NewHash string         `json:"newHash,omitempty"`
+}
+
+// DiffAsar compares the files (and links) of two archives, in path order.
+// unpacked files that aren't on disk (an asar copied without its .unpacked
+// folder) are compared by their header only
+func DiffAsar(oldArchive, newArchive *AsarArchive) ([]AsarChange, error) {
+	oldFiles, err := asarFiles(oldArchive)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := asarFiles(newArchive)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []AsarChange
+	for p, o := range oldFiles {
+		n, ok := newFiles[p]
+		if !ok {
+			changes = append(changes, AsarChange{Path: p, Kind: AsarRemoved, OldSize: o.Size})
+			continue
+		}
+		if o.Link != "" || n.Link != "" {
+			if o.Link != n.Link {
+				changes = append(changes, AsarChange{Path: p, Kind: AsarChanged})
+			}
+			continue
+		}
+
+		// sizes are free, hashes may mean reading both files
+		if o.Size == n.Size && o.Integrity == nil && n.Integrity == nil {
+			same, err := sameContents(oldArchive, o, newArchive, n)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("%s: %w", p, err)
+			}
+			if same || os.IsNotExist(err) {
+				continue
+			}
+		}
+		oldHash, err := diffHash(oldArchive, o)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		newHash, err := diffHash(newArchive, n)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if oldHash != newHash || (oldHash == "" && o.Size != n.Size) {
+			changes = append(changes, AsarChange{Path: p, Kind: AsarChanged, OldSize: o.Size, NewSize: n.Size, OldHash: oldHash, NewHash: newHash})
+		}
+	}
+	for p, n := range newFiles {
+		if _, ok := oldFiles[p]; !ok {
+			changes = append(changes, AsarChange{Path: p, Kind: AsarAdded, NewSize: n.Size})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	// the hashes of added and removed files too
+	for i, c := range changes {
+		switch c.Kind {
+		case AsarRemoved:
+			changes[i].OldHash, err = diffHash(oldArchive, oldFiles[c.Path])
+		case AsarAdded:
+			changes[i].NewHash, err = diffHash(newArchive, newFiles[c.Path])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Path, err)
+		}
+	}
+	return changes, nil
+}
+
+// diffHash is FileHash, "" for links and unpacked files we can't read
+func diffHash(a *AsarArchive, e *AsarEntry) (string, error) {
+	if e.Link != "" {
+		return "", nil
+	}
+	sum, err := a.FileHash(e)
+	if e.Unpacked && os.IsNotExist(err) {
+		return "", nil
+	}
+	return sum, err
+}
+
+func asarFiles(a *AsarArchive) (map[string]*AsarEntry, error) {
+	files := map[string]*AsarEntry{}
+	err := a.Root.Walk(func(p string, e *AsarEntry) error {
+		if !e.IsDir {
+			files[p] = e
+		}
+		return nil
+	})
+	return files, err
+}
+
+func sameContents(a *AsarArchive, ae *AsarEntry, b *AsarArchive, be *AsarEntry) (bool, error) {
+	ar, err := a.OpenFile(ae)
+	if err != nil {
+		return false, err
+	}
+	defer ar.Close()
+	br, err := b.OpenFile(be)
+	if err != nil {
+		return false, err
+	}
+	defer br.Close()
+
+	abuf, bbuf := make([]byte, 64<<10), make([]byte, 64<<10)
+	for {
+		an, aerr := io.ReadFull(ar, abuf)
+		bn, berr := io.ReadFull(br, bbuf)
+		if !bytes.Equal(abuf[:an], bbuf[:bn]) {
+			return false, nil
+		}
+		if aerr == io.EOF || aerr == io.ErrUnexpectedEOF {
+			return berr == io.EOF || berr == io.ErrUnexpectedEOF, nil
+		}
+		if aerr != nil {
+			return false, aerr
+		}
+		if berr != nil {
+			return false, berr
+		}
+	}
+}
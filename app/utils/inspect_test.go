@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// asar links are relative to the root of the archive, the way npm's
+// node_modules/.bin links come out of the packer
+func TestVerifyAsarLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs symlinks")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app")
+	writeTree(t, src, map[string]string{
+		"package.json":            `{"main":"index.js"}`,
+		"index.js":                "",
+		"node_modules/foo/cli.js": "#!/usr/bin/env node\n",
+		"node_modules/.bin/.keep": "",
+	})
+	if err := os.Symlink("../foo/cli.js", filepath.Join(src, "node_modules", ".bin", "foo")); err != nil {
+		t.Fatal(err)
+	}
+	asarPath := filepath.Join(dir, "app.asar")
+	if err := PackFolderToAsar(src, asarPath, PackOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := OpenAsar(asarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := a.Find("node_modules/.bin/foo")
+	a.Close()
+	if link == nil || link.Link != "node_modules/foo/cli.js" {
+		t.Fatalf("packed link is %+v, want one to node_modules/foo/cli.js", link)
+	}
+
+	problems, err := VerifyAsar(asarPath, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Errorf("%s: %s", p.Path, p.Message)
+	}
+}
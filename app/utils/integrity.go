@@ -0,0 +1,333 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// same values @electron/asar writes
+const (
+	integrityAlgorithm = "SHA256"
+	integrityBlockSize = 4 << 20
+)
+
+// FileIntegrity hashes a file the way @electron/asar does: the whole file,
+// plus one hash per 4MB block. The last block is always hashed, even when
+// it's empty.
+func FileIntegrity(r io.Reader) (*AsarIntegrity, error) {
+	fileHash := sha256.New()
+	integrity := &AsarIntegrity{
+		Algorithm: integrityAlgorithm,
+		BlockSize: integrityBlockSize,
+		Blocks:    []string{},
+	}
+
+	block := make([]byte, integrityBlockSize)
+	for {
+		n, err := io.ReadFull(r, block)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+
+		fileHash.Write(block[:n])
+		blockHash := sha256.Sum256(block[:n])
+		integrity.Blocks = append(integrity.Blocks, hex.EncodeToString(blockHash[:]))
+
+		if n < integrityBlockSize {
+			break
+		}
+	}
+
+	integrity.Hash = hex.EncodeToString(fileHash.Sum(nil))
+	return integrity, nil
+}
+
+// AsarHeaderHash is what electron compares against the integrity record of
+// the app: the sha256 of the raw json header string.
+func AsarHeaderHash(asarPath string) (string, error) {
+	f, err := os.Open(asarPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	header, _, err := readAsarHeader(f, info.Size())
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(header)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SetPlistAsarIntegrity writes the header hash into the ElectronAsarIntegrity
+// key of a macOS Info.plist, e.g. for "Resources/app.asar":
+//
+//	<key>ElectronAsarIntegrity</key>
+//	<dict>
+//		<key>Resources/app.asar</key>
+//		<dict>
+//			<key>algorithm</key>
+//			<string>SHA256</string>
+//			<key>hash</key>
+//			<string>...</string>
+//		</dict>
+//	</dict>
+func SetPlistAsarIntegrity(plistPath, asarKey, hash string) error {
+	data, err := os.ReadFile(plistPath)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte("bplist")) {
+		return errors.New("binary Info.plist is not supported")
+	}
+
+	plist := string(data)
+	entry := fmt.Sprintf("<key>%s</key>\n\t\t<dict>\n\t\t\t<key>algorithm</key>\n\t\t\t<string>%s</string>\n\t\t\t<key>hash</key>\n\t\t\t<string>%s</string>\n\t\t</dict>",
+		html.EscapeString(asarKey), integrityAlgorithm, hash)
+
+	integrityStart := strings.Index(plist, "<key>ElectronAsarIntegrity</key>")
+	if integrityStart < 0 {
+		// no record yet, add one at the end of the top level dict
+		end := strings.LastIndex(plist, "</dict>")
+		if end < 0 {
+			return errors.New("Info.plist has no top level dict")
+		}
+		record := "\t<key>ElectronAsarIntegrity</key>\n\t<dict>\n\t\t" + entry + "\n\t</dict>\n"
+		plist = plist[:end] + record + plist[end:]
+		return writeFileAtomic(plistPath, []byte(plist))
+	}
+
+	// find the dict for our asar inside the integrity record
+	outerStart, outerEnd, err := plistDictAfter(plist, integrityStart)
+	if err != nil {
+		return err
+	}
+	outer := plist[outerStart:outerEnd]
+
+	keyTag := "<key>" + html.EscapeString(asarKey) + "</key>"
+	keyStart := strings.Index(outer, keyTag)
+	if keyStart < 0 {
+		// record exists but not for this file
+		insertAt := outerStart + strings.Index(outer, "<dict>") + len("<dict>")
+		plist = plist[:insertAt] + "\n\t\t" + entry + plist[insertAt:]
+		return writeFileAtomic(plistPath, []byte(plist))
+	}
+
+	_, innerEnd, err := plistDictAfter(plist, outerStart+keyStart)
+	if err != nil {
+		return err
+	}
+
+	plist = plist[:outerStart+keyStart] + entry + plist[innerEnd:]
+	return writeFileAtomic(plistPath, []byte(plist))
+}
+
+// writeFileAtomic replaces path with data through a temp file next to it,
+// keeping its mode. a crash halfway leaves the old file, never half of one
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// plistDictAfter returns the bounds of the first <dict>...</dict> after pos,
+// taking nested dicts into account
+func plistDictAfter(plist string, pos int) (int, int, error) {
+	start := strings.Index(plist[pos:], "<dict>")
+	if start < 0 {
+		return 0, 0, errors.New("malformed Info.plist")
+	}
+	start += pos
+
+	depth := 0
+	for i := start; i < len(plist); {
+		switch {
+		case strings.HasPrefix(plist[i:], "<dict>"):
+			depth++
+			i += len("<dict>")
+		case strings.HasPrefix(plist[i:], "</dict>"):
+			depth--
+			i += len("</dict>")
+			if depth == 0 {
+				return start, i, nil
+			}
+		default:
+			i++
+		}
+	}
+	return 0, 0, errors.New("malformed Info.plist")
+}
+
+// SetPEAsarIntegrity updates the INTEGRITY/ELECTRONASAR resource of a windows
+// executable. The resource is json like
+//
+//	[{"file":"resources\\app.asar","alg":"SHA256","value":"<hex>"}]
+//
+// and a sha256 is always 64 characters, so the new hash is written in place.
+func SetPEAsarIntegrity(exePath, hash string) error {
+	if len(hash) != sha256.Size*2 {
+		return fmt.Errorf("invalid sha256 %q", hash)
+	}
+
+	offset, size, err := findPEResource(exePath, "INTEGRITY", "ELECTRONASAR")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(exePath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, offset); err != nil {
+		return err
+	}
+
+	marker := []byte(`"value":"`)
+	i := bytes.Index(data, marker)
+	if i < 0 || i+len(marker)+len(hash) > len(data) {
+		return errors.New("unexpected ELECTRONASAR integrity resource")
+	}
+	i += len(marker)
+
+	_, err = f.WriteAt([]byte(hash), offset+int64(i))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// findPEResource walks the .rsrc directory (type -> name -> language) and
+// returns the file offset and size of the first matching resource
+func findPEResource(exePath, typeName, resName string) (int64, int64, error) {
+	file, err := pe.Open(exePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	rsrc := file.Section(".rsrc")
+	if rsrc == nil {
+		return 0, 0, errors.New("executable has no resources")
+	}
+	data, err := rsrc.Data()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	typeDir, err := peResourceLookup(data, 0, typeName)
+	if err != nil {
+		return 0, 0, err
+	}
+	nameDir, err := peResourceLookup(data, typeDir, resName)
+	if err != nil {
+		return 0, 0, err
+	}
+	// any language will do
+	langEntry, err := peResourceLookup(data, nameDir, "")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if langEntry+8 > uint32(len(data)) {
+		return 0, 0, errors.New("malformed resource directory")
+	}
+	rva := binary.LittleEndian.Uint32(data[langEntry:])
+	size := binary.LittleEndian.Uint32(data[langEntry+4:])
+	if rva < rsrc.VirtualAddress || rva-rsrc.VirtualAddress+size > uint32(len(data)) {
+		return 0, 0, errors.New("resource data outside of .rsrc")
+	}
+
+	return int64(rsrc.Offset) + int64(rva-rsrc.VirtualAddress), int64(size), nil
+}
+
+// peResourceLookup finds a named entry in the resource directory at dirOffset
+// (or the first entry when name is empty) and returns what it points to
+func peResourceLookup(data []byte, dirOffset uint32, name string) (uint32, error) {
+	if dirOffset+16 > uint32(len(data)) {
+		return 0, errors.New("malformed resource directory")
+	}
+	named := binary.LittleEndian.Uint16(data[dirOffset+12:])
+	ids := binary.LittleEndian.Uint16(data[dirOffset+14:])
+
+	for i := uint32(0); i < uint32(named)+uint32(ids); i++ {
+		entry := dirOffset + 16 + i*8
+		if entry+8 > uint32(len(data)) {
+			return 0, errors.New("malformed resource directory")
+		}
+		nameField := binary.LittleEndian.Uint32(data[entry:])
+		target := binary.LittleEndian.Uint32(data[entry+4:]) &^ (1 << 31)
+
+		if name == "" {
+			return target, nil
+		}
+		if nameField&(1<<31) == 0 {
+			continue
+		}
+		if peResourceName(data, nameField&^(1<<31)) == name {
+			return target, nil
+		}
+	}
+
+	return 0, fmt.Errorf("resource %s not found", name)
+}
+
+func peResourceName(data []byte, off uint32) string {
+	if off+2 > uint32(len(data)) {
+		return ""
+	}
+	n := uint32(binary.LittleEndian.Uint16(data[off:]))
+	if off+2+n*2 > uint32(len(data)) {
+		return ""
+	}
+	chars := make([]uint16, n)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(data[off+2+uint32(i)*2:])
+	}
+	return string(utf16.Decode(chars))
+}
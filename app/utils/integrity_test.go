@@ -0,0 +1,340 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// testdata/electron.asar is laid out the way @electron/asar 3.x packs a small
+// slack-like app (pickle header, offsets as strings, integrity with 4MB
+// blocks), its hashes were taken with node's crypto. packing it again with
+// npx @electron/asar pack keeps these tests valid
+const electronAsar = "testdata/electron.asar"
+
+// sha256 of the json header string in electron.asar
+const electronAsarHeaderHash = "e9a53e6b4fe331c98e4c67c6a2f17ebbc69cb625618d1356414632b56954e2bc"
+
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func TestFileIntegrityMatchesElectronAsar(t *testing.T) {
+	archive, err := OpenAsar(electronAsar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	n := 0
+	err = archive.Root.Walk(func(p string, e *AsarEntry) error {
+		if e.IsDir {
+			return nil
+		}
+		n++
+		if e.Integrity == nil {
+			t.Errorf("%s has no integrity in the fixture", p)
+			return nil
+		}
+		r, err := archive.Open(e)
+		if err != nil {
+			return err
+		}
+		got, err := FileIntegrity(r)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, e.Integrity) {
+			t.Errorf("%s: got %+v, @electron/asar wrote %+v", p, got, e.Integrity)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("checked %d files, the fixture has 6", n)
+	}
+}
+
+func TestAsarHeaderHash(t *testing.T) {
+	got, err := AsarHeaderHash(electronAsar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != electronAsarHeaderHash {
+		t.Errorf("header hash is %s, want %s", got, electronAsarHeaderHash)
+	}
+}
+
+// the block hashes below come from @electron/asar's getFileIntegrity run on
+// the same bytes. a file that fills its last block exactly still gets an
+// empty one after it
+func TestFileIntegrityBlocks(t *testing.T) {
+	const full = "a117210941a0b00dcb2d8577e680d84b6fa0eaf760d2afc654c953b9859d54fa"
+	tests := []struct {
+		size   int
+		hash   string
+		blocks []string
+	}{
+		{0, emptySHA256, []string{emptySHA256}},
+		{1, "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d", []string{"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d"}},
+		{integrityBlockSize - 1, "8bc25f24c0f447466930cda6b0ac7405adc7f6348c50204caa9f9a5b6217ed42", []string{"8bc25f24c0f447466930cda6b0ac7405adc7f6348c50204caa9f9a5b6217ed42"}},
+		{integrityBlockSize, full, []string{full, emptySHA256}},
+		{integrityBlockSize + 1, "f4711f6bc42a8dc6520e30e306743855a82c7bdecd6e7d3edfb04b6f4524f7bd", []string{full, "74cd9ef9c7e15f57bdad73c511462ca65cb674c46c49639c60f1b44650fa1dcb"}},
+		{2*integrityBlockSize + 5, "75934ec6907d95413c119970cc9a88dccecccd86bdfbcee656af4e3c520e5a89", []string{full, "9889e2ef8bd7d8fea5ef99243b7784ecd8deaf613bdb7a6c0b3ac56f23078303", "72d4dcdb84714d8ec227299b8c108da65ce924def1ca3e8df56a1de5bf8714bb"}},
+	}
+	for _, tt := range tests {
+		data := make([]byte, tt.size)
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+		got, err := FileIntegrity(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Hash != tt.hash || !reflect.DeepEqual(got.Blocks, tt.blocks) {
+			t.Errorf("%d bytes: got %s %v, want %s %v", tt.size, got.Hash, got.Blocks, tt.hash, tt.blocks)
+		}
+		if got.Algorithm != "SHA256" || got.BlockSize != 4<<20 {
+			t.Errorf("%d bytes: algorithm %s, block size %d", tt.size, got.Algorithm, got.BlockSize)
+		}
+	}
+}
+
+const plistHead = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleName</key>
+	<string>Slack</string>
+	<key>CFBundleURLTypes</key>
+	<array>
+		<dict>
+			<key>CFBundleURLSchemes</key>
+			<array>
+				<string>slack</string>
+			</array>
+		</dict>
+	</array>
+`
+
+const plistTail = `	<key>LSMinimumSystemVersion</key>
+	<string>10.15</string>
+</dict>
+</plist>
+`
+
+// the record SetPlistAsarIntegrity writes for app.asar with hash
+func plistRecord(hash string) string {
+	return "<key>Resources/app.asar</key>\n\t\t<dict>\n\t\t\t<key>algorithm</key>\n\t\t\t<string>SHA256</string>\n\t\t\t<key>hash</key>\n\t\t\t<string>" + hash + "</string>\n\t\t</dict>"
+}
+
+const otherRecord = `<key>Resources/other.asar</key>
+		<dict>
+			<key>algorithm</key>
+			<string>SHA256</string>
+			<key>hash</key>
+			<string>1111</string>
+		</dict>`
+
+func TestSetPlistAsarIntegrity(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		want   string
+	}{
+		{
+			"no record",
+			plistHead + plistTail,
+			plistHead + plistTail[:strings.Index(plistTail, "</dict>")] +
+				"\t<key>ElectronAsarIntegrity</key>\n\t<dict>\n\t\t" + plistRecord("abcd") + "\n\t</dict>\n" +
+				plistTail[strings.Index(plistTail, "</dict>"):],
+		},
+		{
+			"record for another asar",
+			plistHead + "\t<key>ElectronAsarIntegrity</key>\n\t<dict>\n\t\t" + otherRecord + "\n\t</dict>\n" + plistTail,
+			plistHead + "\t<key>ElectronAsarIntegrity</key>\n\t<dict>\n\t\t" + plistRecord("abcd") + "\n\t\t" + otherRecord + "\n\t</dict>\n" + plistTail,
+		},
+		{
+			"record replaced",
+			plistHead + "\t<key>ElectronAsarIntegrity</key>\n\t<dict>\n\t\t" + plistRecord("0000") + "\n\t\t" + otherRecord + "\n\t</dict>\n" + plistTail,
+			plistHead + "\t<key>ElectronAsarIntegrity</key>\n\t<dict>\n\t\t" + plistRecord("abcd") + "\n\t\t" + otherRecord + "\n\t</dict>\n" + plistTail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			plistPath := filepath.Join(dir, "Info.plist")
+			if err := os.WriteFile(plistPath, []byte(tt.before), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := SetPlistAsarIntegrity(plistPath, "Resources/app.asar", "abcd"); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(plistPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+			info, err := os.Stat(plistPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("Info.plist is %v after the write, was 0600", info.Mode().Perm())
+			}
+			if files, _ := os.ReadDir(dir); len(files) != 1 {
+				t.Errorf("%d files next to Info.plist, the temp file was left behind", len(files)-1)
+			}
+		})
+	}
+}
+
+func TestSetPlistAsarIntegrityRejects(t *testing.T) {
+	tests := []struct {
+		name, plist string
+	}{
+		{"binary plist", "bplist00\x00\x01"},
+		{"no top level dict", "<plist version=\"1.0\"></plist>"},
+		{"unclosed record", plistHead + "\t<key>ElectronAsarIntegrity</key>\n\t<dict>\n\t\t<key>x</key>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plistPath := filepath.Join(t.TempDir(), "Info.plist")
+			if err := os.WriteFile(plistPath, []byte(tt.plist), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := SetPlistAsarIntegrity(plistPath, "Resources/app.asar", "abcd"); err == nil {
+				t.Error("wrote into a plist it can't read")
+			}
+			if got, _ := os.ReadFile(plistPath); string(got) != tt.plist {
+				t.Error("a failed write changed Info.plist")
+			}
+		})
+	}
+}
+
+func TestPlistDictAfter(t *testing.T) {
+	plist := "<key>a</key><dict><dict></dict><key>b</key><dict></dict></dict><dict></dict>"
+	start, end, err := plistDictAfter(plist, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plist[start:end]; got != "<dict><dict></dict><key>b</key><dict></dict></dict>" {
+		t.Errorf("got %s, nested dicts weren't skipped", got)
+	}
+	if _, _, err := plistDictAfter("<dict><dict></dict>", 0); err == nil {
+		t.Error("found the end of an unclosed dict")
+	}
+}
+
+// peWithIntegrity builds the smallest PE debug/pe reads: no optional header
+// and one .rsrc section holding INTEGRITY/ELECTRONASAR (language 1033) plus
+// an id resource type that has to be skipped
+func peWithIntegrity(t *testing.T, resource string) string {
+	t.Helper()
+	const (
+		rawOffset = 0x200
+		rva       = 0x1000
+	)
+
+	le := binary.LittleEndian
+	dir := func(named, ids uint16, entries ...uint32) []byte {
+		b := make([]byte, 16)
+		le.PutUint16(b[12:], named)
+		le.PutUint16(b[14:], ids)
+		for _, v := range entries {
+			b = le.AppendUint32(b, v)
+		}
+		return b
+	}
+	name := func(s string) []byte {
+		chars := utf16.Encode([]rune(s))
+		b := le.AppendUint16(nil, uint16(len(chars)))
+		for _, c := range chars {
+			b = le.AppendUint16(b, c)
+		}
+		return b
+	}
+
+	// root at 0, the INTEGRITY dir at 32, the ELECTRONASAR (language) dir
+	// at 56, the data entry at 80, the names at 96 and 116, the resource at 144
+	const subdir = 1 << 31
+	var rsrc []byte
+	rsrc = append(rsrc, dir(1, 1, 96|subdir, 32|subdir, 16, 56|subdir)...)
+	rsrc = append(rsrc, dir(1, 0, 116|subdir, 56|subdir)...)
+	rsrc = append(rsrc, dir(0, 1, 1033, 80)...)
+	rsrc = le.AppendUint32(rsrc, rva+144)
+	rsrc = le.AppendUint32(rsrc, uint32(len(resource)))
+	rsrc = append(rsrc, make([]byte, 8)...)
+	rsrc = append(rsrc, name("INTEGRITY")...)
+	rsrc = append(rsrc, name("ELECTRONASAR")...)
+	rsrc = append(rsrc, make([]byte, 144-len(rsrc))...)
+	rsrc = append(rsrc, resource...)
+
+	exe := make([]byte, rawOffset)
+	copy(exe, "MZ")
+	le.PutUint32(exe[0x3c:], 0x40)
+	copy(exe[0x40:], "PE\x00\x00")
+	coff := exe[0x44:]
+	le.PutUint16(coff[0:], 0x8664) // amd64
+	le.PutUint16(coff[2:], 1)      // sections
+	section := exe[0x44+20:]
+	copy(section, ".rsrc")
+	le.PutUint32(section[8:], uint32(len(rsrc)))
+	le.PutUint32(section[12:], rva)
+	le.PutUint32(section[16:], uint32(len(rsrc)))
+	le.PutUint32(section[20:], rawOffset)
+	exe = append(exe, rsrc...)
+
+	path := filepath.Join(t.TempDir(), "slack.exe")
+	if err := os.WriteFile(path, exe, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSetPEAsarIntegrity(t *testing.T) {
+	const (
+		oldHash = "0000000000000000000000000000000000000000000000000000000000000000"
+		newHash = "e9a53e6b4fe331c98e4c67c6a2f17ebbc69cb625618d1356414632b56954e2bc"
+	)
+	resource := `[{"file":"resources\\app.asar","alg":"SHA256","value":"` + oldHash + `"}]`
+	exePath := peWithIntegrity(t, resource)
+	before, _ := os.ReadFile(exePath)
+
+	offset, size, err := findPEResource(exePath, "INTEGRITY", "ELECTRONASAR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(before[offset : offset+size]); got != resource {
+		t.Fatalf("found %q, want the integrity resource", got)
+	}
+
+	if err := SetPEAsarIntegrity(exePath, newHash); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.ReadFile(exePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bytes.Replace(before, []byte(oldHash), []byte(newHash), 1)
+	if !bytes.Equal(after, want) {
+		t.Error("SetPEAsarIntegrity changed more than the hash")
+	}
+
+	if err := SetPEAsarIntegrity(exePath, "abcd"); err == nil {
+		t.Error("wrote a hash that isn't a sha256")
+	}
+	if _, _, err := findPEResource(exePath, "INTEGRITY", "OTHER"); err == nil {
+		t.Error("found a resource that isn't there")
+	}
+}
@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PatchAsar writes src to dst with edits applied, without extracting it.
+// every edit gets the current contents of its file and returns the new ones.
+// a path that isn't in the archive gets nil and is added unless nil comes
+// back, returning nil for an existing file removes it. unchanged files are
+// copied straight from src, the header (offsets, integrity) is rebuilt.
+// <src>.unpacked isn't copied, dst only works in src's place next to it.
+// an edited or added file always goes into the archive, even one that was
+// unpacked, so no edit is lost when only the asar is replaced
+func PatchAsar(src, dst string, edits map[string]func([]byte) []byte) error {
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		return fmt.Errorf("can't patch %s in place", src)
+	}
+
+	archive, err := OpenAsar(src)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	root := cloneAsarEntry(archive.Root, nil)
+	// new contents of edited and added files
+	contents := map[*AsarEntry][]byte{}
+
+	names := make([]string, 0, len(edits))
+	for name := range edits {
+		names = append(names, name)
+	}
+	// same result whatever order the map comes in
+	sort.Strings(names)
+
+	for _, name := range names {
+		clean := strings.Trim(path.Clean("/"+name), "/")
+		if clean == "" {
+			return fmt.Errorf("invalid path %q", name)
+		}
+
+		e := root.Find(clean)
+		var old []byte
+		if e != nil {
+			if e.IsDir || e.Link != "" {
+				return fmt.Errorf("%s is not a regular file", clean)
+			}
+			old, err = archive.ReadAnyFile(clean)
+			if err != nil {
+				return err
+			}
+		}
+
+		data := edits[name](old)
+		switch {
+		case data == nil && e == nil:
+			continue
+		case data == nil:
+			removeAsarEntry(e)
+			continue
+		case int64(len(data)) > maxAsarFileSize:
+			return fmt.Errorf("%s: file is larger than 4GB", clean)
+		case e == nil:
+			e, err = addAsarFile(root, clean)
+			if err != nil {
+				return err
+			}
+		}
+
+		e.Size = int64(len(data))
+		e.Integrity, _ = FileIntegrity(bytes.NewReader(data))
+		e.Unpacked = false
+		contents[e] = data
+	}
+
+	// lay the packed files out again in header order, remembering where
+	// each one came from
+	var packed []*AsarEntry
+	sources := map[*AsarEntry]*AsarEntry{}
+	var offset int64
+	err = root.Walk(func(p string, e *AsarEntry) error {
+		if e.IsDir || e.Link != "" || e.Unpacked {
+			return nil
+		}
+		if _, edited := contents[e]; !edited {
+			sources[e] = archive.Find(p)
+		}
+		e.Offset = offset
+		offset += e.Size
+		packed = append(packed, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	err = writePatchedAsar(out, archive, root, packed, sources, contents)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+func writePatchedAsar(out *os.File, archive *AsarArchive, root *AsarEntry, packed []*AsarEntry, sources map[*AsarEntry]*AsarEntry, contents map[*AsarEntry][]byte) error {
+	if _, err := out.Write(EncodeAsarHeader(root)); err != nil {
+		return fmt.Errorf("failed to write asar header: %w", err)
+	}
+
+	// files that sit next to each other in src are copied in one go, which
+	// is most of them
+	var runStart, runLen int64
+	flush := func() error {
+		if runLen == 0 {
+			return nil
+		}
+		if _, err := archive.f.Seek(archive.DataOffset+runStart, io.SeekStart); err != nil {
+			return err
+		}
+		// *os.File to *os.File through a LimitedReader, the kernel can copy it
+		n, err := out.ReadFrom(&io.LimitedReader{R: archive.f, N: runLen})
+		if err == nil && n != runLen {
+			err = fmt.Errorf("%s ended early", archive.Path)
+		}
+		runLen = 0
+		return err
+	}
+
+	for _, e := range packed {
+		if data, edited := contents[e]; edited {
+			if err := flush(); err != nil {
+				return err
+			}
+			if _, err := out.Write(data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		from := sources[e]
+		if runLen > 0 && runStart+runLen == from.Offset {
+			runLen += from.Size
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		runStart, runLen = from.Offset, from.Size
+	}
+	return flush()
+}
+
+func cloneAsarEntry(e, parent *AsarEntry) *AsarEntry {
+	c := *e
+	c.Parent = parent
+	c.Children = nil
+	for _, child := range e.Children {
+		c.Children = append(c.Children, cloneAsarEntry(child, &c))
+	}
+	return &c
+}
+
+func removeAsarEntry(e *AsarEntry) {
+	siblings := e.Parent.Children
+	for i, s := range siblings {
+		if s == e {
+			e.Parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+			return
+		}
+	}
+}
+
+// addAsarFile adds an empty file at p and the folders it needs, sorted in
+// among the others like PackFolderToAsar would have
+func addAsarFile(root *AsarEntry, p string) (*AsarEntry, error) {
+	dir := root
+	parts := strings.Split(p, "/")
+	for i, name := range parts {
+		if !validAsarName(name) {
+			return nil, fmt.Errorf("invalid path %q", p)
+		}
+		e := dir.Find(name)
+		if e == nil {
+			e = &AsarEntry{Name: name, Parent: dir, IsDir: i < len(parts)-1, Unpacked: dir.Unpacked}
+			at := sort.Search(len(dir.Children), func(j int) bool { return dir.Children[j].Name > name })
+			dir.Children = append(dir.Children[:at], append([]*AsarEntry{e}, dir.Children[at:]...)...)
+		} else if i < len(parts)-1 && !e.IsDir {
+			return nil, fmt.Errorf("%s: %s is not a folder", p, e.Path())
+		}
+		dir = e
+	}
+	return dir, nil
+}
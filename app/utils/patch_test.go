@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// install only replaces app.asar, so an edit to an unpacked file has to end
+// up inside it and nothing may be written next to it
+func TestPatchAsarUnpacked(t *testing.T) {
+	src := packTree(t, map[string]string{
+		"package.json":      `{"main":"index.js"}`,
+		"index.js":          "console.log('slack')\n",
+		"native/addon.node": "binary",
+	}, PackOptions{Unpack: []string{"index.js", "native"}})
+
+	dst := filepath.Join(t.TempDir(), "app.asar")
+	err := PatchAsar(src, dst, map[string]func([]byte) []byte{
+		"index.js": func(old []byte) []byte {
+			return append([]byte("require('./inject.js');\n"), old...)
+		},
+		"native/new.js": func([]byte) []byte { return []byte("new") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dst + ".unpacked"); !os.IsNotExist(err) {
+		t.Errorf("PatchAsar wrote %s.unpacked", dst)
+	}
+
+	// read it where install puts it, next to the original .unpacked folder
+	installed := filepath.Join(filepath.Dir(src), "installed.asar")
+	if err := os.Rename(dst, installed); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(src+".unpacked", installed+".unpacked"); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := OpenAsar(installed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for name, want := range map[string]string{
+		"index.js":      "require('./inject.js');\nconsole.log('slack')\n",
+		"native/new.js": "new",
+	} {
+		e := a.Find(name)
+		if e == nil || e.Unpacked {
+			t.Errorf("%s isn't packed: %+v", name, e)
+			continue
+		}
+		got, err := a.ReadFile(name)
+		if err != nil || string(got) != want {
+			t.Errorf("%s is %q (%v), want %q", name, got, err, want)
+		}
+	}
+	if e := a.Find("native/addon.node"); e == nil || !e.Unpacked {
+		t.Errorf("native/addon.node should still be unpacked: %+v", e)
+	}
+	if got, err := a.ReadAnyFile("native/addon.node"); err != nil || string(got) != "binary" {
+		t.Errorf("native/addon.node is %q (%v)", got, err)
+	}
+}
+
+// bigAsar packs a 300MB archive, which is about the size of slack's
+func bigAsar(b *testing.B) (dir, asarPath string, size int64) {
+	b.Helper()
+	dir = b.TempDir()
+	src := filepath.Join(dir, "app")
+	writeTree(b, src, map[string]string{
+		"package.json": `{"main":"index.js"}`,
+		"index.js":     "console.log('slack')\n",
+	})
+	// 300 files of 1MB, random so nothing gets smaller on the way
+	chunk := make([]byte, 1<<20)
+	for i := 0; i < 300; i++ {
+		if _, err := rand.Read(chunk); err != nil {
+			b.Fatal(err)
+		}
+		p := filepath.Join(src, "dist", "chunks", fmt.Sprintf("%03d.js", i))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(p, chunk, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	asarPath = filepath.Join(dir, "app.asar")
+	if err := PackFolderToAsar(src, asarPath, PackOptions{}); err != nil {
+		b.Fatal(err)
+	}
+	info, err := os.Stat(asarPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return dir, asarPath, info.Size()
+}
+
+// BenchmarkPatchAsar patches one small file in a 300MB archive.
+// go test -bench PatchAsar -benchtime 5x
+func BenchmarkPatchAsar(b *testing.B) {
+	if testing.Short() {
+		b.Skip("writes 300MB")
+	}
+	dir, asarPath, size := bigAsar(b)
+
+	edits := map[string]func([]byte) []byte{
+		"index.js": func(old []byte) []byte {
+			return append([]byte("require('./inject.js');\n"), old...)
+		},
+		"inject.js": func([]byte) []byte { return bytes.Repeat([]byte("x"), 4096) },
+	}
+	dst := filepath.Join(dir, "app-new.asar")
+
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := PatchAsar(asarPath, dst, edits); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkExtractRepack makes the same change the way installs did before
+// PatchAsar, extracting everything and packing it again, to compare against.
+// go test -bench 'PatchAsar|ExtractRepack' -benchtime 5x
+func BenchmarkExtractRepack(b *testing.B) {
+	if testing.Short() {
+		b.Skip("writes 300MB")
+	}
+	dir, asarPath, size := bigAsar(b)
+	out := filepath.Join(dir, "extracted")
+	dst := filepath.Join(dir, "app-new.asar")
+
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := os.RemoveAll(out); err != nil {
+			b.Fatal(err)
+		}
+		if err := UnpackAsarToFolder(asarPath, out); err != nil {
+			b.Fatal(err)
+		}
+
+		index := filepath.Join(out, "index.js")
+		old, err := os.ReadFile(index)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(index, append([]byte("require('./inject.js');\n"), old...), 0644); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(out, "inject.js"), bytes.Repeat([]byte("x"), 4096), 0644); err != nil {
+			b.Fatal(err)
+		}
+
+		if err := PackFolderToAsar(out, dst, PackOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,6 +1,13 @@
 //@ts-ignore
 import { build } from "bun";
 
+// the public half of the release key, the loader checks manifest.json with
+// it before updating itself. without it updates are refused
+const manifestPublicKey = process.env.SNAIL_MANIFEST_PUBLIC_KEY ?? "";
+if (!manifestPublicKey) {
+  console.warn("SNAIL_MANIFEST_PUBLIC_KEY is not set, this loader won't update itself");
+}
+
 async function run() {
   await build({
     entryPoints: ["./src/main.ts", "./src/preload.ts"],
@@ -9,6 +16,9 @@ async function run() {
     target: "node",
     format: "cjs",
     external: ["electron"],
+    define: {
+      SNAIL_MANIFEST_PUBLIC_KEY: JSON.stringify(manifestPublicKey),
+    },
   });
 }
 
@@ -1,6 +1,7 @@
 import * as os from "os";
 import * as path from "path";
 import * as fs from "fs";
+import * as crypto from "crypto";
 import { app, ipcMain, session } from "electron";
 
 import {
@@ -265,44 +266,97 @@ ipcMain.on("SNAIL_GET_PLUGIN_FILE", (e, pluginId: string) => {
 
 // ---------- Updating Snail loader \o/ ----------
 
+// public half of the release key assets/manifest.json is signed with, same
+// as manifestPublicKey in the installer. build.ts fills it in from
+// SNAIL_MANIFEST_PUBLIC_KEY
+declare const SNAIL_MANIFEST_PUBLIC_KEY: string;
+
+// der prefix that turns a raw ed25519 key into an spki one node can load
+const ED25519_SPKI_PREFIX = Buffer.from("302a300506032b6570032100", "hex");
+
+interface AssetManifest {
+  version: string;
+  assets: { name: string; size: number; sha256: string }[];
+}
+
+async function fetchBuffer(url: string): Promise<Buffer> {
+  const res = await fetch(url);
+  if (!res.ok) throw new Error(`Failed to download ${url}: ${res.status}`);
+  return Buffer.from(await res.arrayBuffer());
+}
+
+async function fetchVerifiedManifest(serverUrl: string): Promise<AssetManifest> {
+  const [data, sig] = await Promise.all([
+    fetchBuffer(`${serverUrl}/assets/manifest.json`),
+    fetchBuffer(`${serverUrl}/assets/manifest.json.sig`),
+  ]);
+
+  if (!SNAIL_MANIFEST_PUBLIC_KEY) {
+    throw new Error("this loader was built without a manifest key");
+  }
+  const key = crypto.createPublicKey({
+    key: Buffer.concat([
+      ED25519_SPKI_PREFIX,
+      Buffer.from(SNAIL_MANIFEST_PUBLIC_KEY, "base64"),
+    ]),
+    format: "der",
+    type: "spki",
+  });
+  const signature = Buffer.from(sig.toString("utf8").trim(), "base64");
+  if (!crypto.verify(null, data, key, signature)) {
+    throw new Error("manifest.json signature does not match");
+  }
+
+  return JSON.parse(data.toString("utf8"));
+}
+
+// downloads an asset and only returns it if it matches the signed manifest
+async function fetchVerifiedAsset(
+  serverUrl: string,
+  manifest: AssetManifest,
+  name: string,
+): Promise<Buffer> {
+  const entry = manifest.assets.find((a) => a.name === name);
+  if (!entry) throw new Error(`${name} is not in the signed manifest`);
+
+  const data = await fetchBuffer(`${serverUrl}/assets/${name}`);
+  const hash = crypto.createHash("sha256").update(data).digest("hex");
+  if (data.length !== entry.size || hash !== entry.sha256) {
+    throw new Error(`${name} does not match the signed manifest`);
+  }
+  return data;
+}
+
 function updateLoader() {
   const internalDir = path.join(BASE_DIR, "internal");
 
   const serverUrl =
     readConfig().serverUrl || "https://assets.snail.hackclub.cc";
-  const preloadUrl = `${serverUrl}/assets/preload.js`;
-  const mainUrl = `${serverUrl}/assets/main.js`;
 
   fs.mkdirSync(internalDir, { recursive: true });
 
-  // Download preload.js
-  fetch(preloadUrl)
-    .then((res) => {
-      if (!res.ok)
-        throw new Error(`Failed to download preload.js: ${res.status}`);
-      return res.text();
-    })
-    .then((data) => {
-      fs.writeFileSync(PRELOAD, data, "utf8");
-      console.log("[snail] Updated preload.js");
-    })
-    .catch((err) => {
-      console.error("[snail] Error updating preload.js:", err);
-    });
-
-  // Download main.js
-  const mainPath = path.join(internalDir, "main.js");
-  fetch(mainUrl)
-    .then((res) => {
-      if (!res.ok) throw new Error(`Failed to download main.js: ${res.status}`);
-      return res.text();
-    })
-    .then((data) => {
-      fs.writeFileSync(mainPath, data, "utf8");
-      console.log("[snail] Updated main.js");
-    })
+  const targets: [string, string][] = [
+    ["preload.js", PRELOAD],
+    ["main.js", path.join(internalDir, "main.js")],
+  ];
+
+  fetchVerifiedManifest(serverUrl)
+    .then((manifest) =>
+      Promise.all(
+        targets.map(([name, dest]) =>
+          fetchVerifiedAsset(serverUrl, manifest, name)
+            .then((data) => {
+              fs.writeFileSync(dest, data);
+              console.log(`[snail] Updated ${name}`);
+            })
+            .catch((err) => {
+              console.error(`[snail] Error updating ${name}:`, err);
+            }),
+        ),
+      ),
+    )
     .catch((err) => {
-      console.error("[snail] Error updating main.js:", err);
+      console.error("[snail] Not updating the loader:", err);
     });
 }
 
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// assets change with every release, so clients may keep them but have to
+// revalidate with the ETag before using them
+const assetCacheControl = "no-cache"
+
+// etags by path, only hashed again when the file changes
+var (
+	etagMu    sync.Mutex
+	etagCache = map[string]cachedETag{}
+)
+
+type cachedETag struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+func strongETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// serveAssetBytes serves generated content, If-None-Match is handled by ServeContent
+func serveAssetBytes(w http.ResponseWriter, r *http.Request, name string, data []byte) {
+	w.Header().Set("ETag", strongETag(data))
+	w.Header().Set("Cache-Control", assetCacheControl)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
+
+// serveAssetFile serves a file from assets/ with a strong etag of its contents
+func serveAssetFile(w http.ResponseWriter, r *http.Request, file string) {
+	// http.Dir keeps the path inside assets/
+	f, err := http.Dir(assetsDir).Open("/" + file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag, err := fileETag(file, info.ModTime(), info.Size(), f)
+	if err != nil {
+		http.Error(w, "Could not read "+file, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", assetCacheControl)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func fileETag(file string, modTime time.Time, size int64, f io.ReadSeeker) (string, error) {
+	etagMu.Lock()
+	cached, ok := etagCache[file]
+	etagMu.Unlock()
+	if ok && cached.modTime.Equal(modTime) && cached.size == size {
+		return cached.etag, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+
+	etagMu.Lock()
+	etagCache[file] = cachedETag{modTime, size, etag}
+	etagMu.Unlock()
+	return etag, nil
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -23,8 +25,17 @@ type Info struct {
 }
 
 func main() {
-	fetchLatestContent()
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	godotenv.Load()
+	manifest, err := checkManifest()
+	if err != nil {
+		// installers would refuse what we serve anyway, better nobody gets it
+		log.Fatal("Refusing to start, the assets don't match the signed manifest: ", err)
+	}
+	log.Printf("Assets match the signed manifest for loader %s\n", manifest.Version)
 
 	port := 8080
 	if envPort := os.Getenv("PORT"); envPort != "" {
@@ -42,47 +53,12 @@ func main() {
 		w.Write([]byte("🐌"))
 	})
 
-	r.Get("/assets/*", func(w http.ResponseWriter, r *http.Request) {
-		file := r.URL.Path[len("/assets/"):]
-		if file == "config.json" {
-			// change INJECT_LOADER_VERSION to the latest tag from github
-			tag, err := getLatestGitHubTag()
-			if err != nil {
-				tag = "unknown"
-			}
-			// use regexp to replace INJECT_LOADER_VERSION in config.json
-			// load config.json
-			configFile, err := os.ReadFile("./assets/config.json")
-			if err != nil {
-				http.Error(w, "Could not read config.json", http.StatusInternalServerError)
-				return
-			}
-			var config map[string]any
-			err = json.Unmarshal(configFile, &config)
-			if err != nil {
-				http.Error(w, "Could not parse config.json", http.StatusInternalServerError)
-				return
-			}
-			config["loaderVersion"] = tag
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(config)
-			return
-		} else {
-			http.ServeFile(w, r, "./assets/"+file)
-		}
-	})
+	r.Get("/assets/*", assetsHandler(manifest))
 
 	r.Get("/info.json", func(w http.ResponseWriter, r *http.Request) {
-		tag, err := getLatestGitHubTag()
-		if err != nil {
-			// send a version: unknown
-			info := Info{Version: "unknown"}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(info)
-			return
-		}
-
-		info := Info{Version: tag}
+		// the version that was signed, not the latest tag: that's what
+		// /assets/ serves
+		info := Info{Version: manifest.Version}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(info)
 	})
@@ -93,6 +69,83 @@ func main() {
 	}
 }
 
+func runCommand(name string, args []string) int {
+	godotenv.Load()
+
+	var err error
+	switch name {
+	case "keygen":
+		err = runKeygen(args)
+	case "sign":
+		err = runSign(args)
+	case "verify":
+		err = runVerify(args)
+	case "build":
+		err = runBuild(args)
+	case "bundle":
+		err = runBundle(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\nusage: webserver [build | keygen | sign | verify | bundle] [flags]\n", name)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// checkManifest verifies assets/ against the signed manifest before anything
+// is served. the manifest is signed offline, the server can't fix it, it can
+// only refuse to serve what installers would refuse to inject
+func checkManifest() (*Manifest, error) {
+	var pub ed25519.PublicKey
+	if key := os.Getenv("SNAIL_MANIFEST_PUBLIC_KEY"); key != "" {
+		var err error
+		pub, err = parsePublicKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("SNAIL_MANIFEST_PUBLIC_KEY: %w", err)
+		}
+	} else {
+		log.Println("Warning: no SNAIL_MANIFEST_PUBLIC_KEY, only checking the asset hashes")
+	}
+
+	return verifyAssets(assetsDir, pub)
+}
+
+// assetsHandler serves the files the manifest lists and config.json, nothing
+// else in assets/ goes out
+func assetsHandler(manifest *Manifest) http.HandlerFunc {
+	served := map[string]bool{}
+	for name := range unsignedAssets {
+		served[name] = true
+	}
+	for _, asset := range manifest.Assets {
+		served[asset.Name] = true
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		file := r.URL.Path[len("/assets/"):]
+		if !served[file] {
+			http.NotFound(w, r)
+			return
+		}
+
+		if file == "config.json" {
+			data, err := defaultConfig(manifest.Version)
+			if err != nil {
+				http.Error(w, "Could not read config.json", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			serveAssetBytes(w, r, file, append(data, '\n'))
+			return
+		}
+		serveAssetFile(w, r, file)
+	}
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s\n", r.Method, r.URL.Path)
@@ -113,32 +166,19 @@ func getLatestGitHubTag() (string, error) {
 	return tag, nil
 }
 
-func fetchLatestContent() {
-	// builds the latest version of prealod.js and main.js if the release tag changed
-
-	latestTag, err := getLatestGitHubTag()
-	if err != nil {
-		log.Println("No tag found!")
-		latestTag = "none"
+// runBuild builds the loader from core/ into assets/. it runs on the release
+// machine before sign, the server only serves what was signed
+func runBuild(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
 	}
 
-	currentTag, err := loadCurrentTag()
-	if err != nil || currentTag != latestTag {
-		log.Println("New version detected:", latestTag)
-		err := buildLoader()
-		if err != nil {
-			log.Println("Error building loader:", err)
-			return
-		}
-		err = saveCurrentTag(latestTag)
-		if err != nil {
-			log.Println("Error saving current tag:", err)
-			return
-		}
-		log.Println("Loader built successfully for version:", latestTag)
-	} else {
-		log.Println("No new version detected. Current version is up to date:", currentTag)
+	if err := buildLoader(); err != nil {
+		return err
 	}
+	fmt.Println("built the loader into", assetsDir+", sign it before deploying")
+	return nil
 }
 
 func buildLoader() error {
@@ -166,15 +206,3 @@ func buildLoader() error {
 
 	return nil
 }
-
-func saveCurrentTag(tag string) error {
-	return os.WriteFile(".current_tag", []byte(tag), 0644)
-}
-
-func loadCurrentTag() (string, error) {
-	data, err := os.ReadFile(".current_tag")
-	if err != nil {
-		return "", err
-	}
-	return string(data), nil
-}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// servedAssets moves signed assets to ./assets of a temp working directory,
+// where the server looks for them
+func servedAssets(t *testing.T) ed25519.PublicKey {
+	t.Helper()
+	dir, pub := signedAssets(t)
+	root := t.TempDir()
+	if err := os.Rename(dir, filepath.Join(root, "assets")); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(root)
+	return pub
+}
+
+func TestCheckManifest(t *testing.T) {
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		name   string
+		key    func(pub ed25519.PublicKey) string
+		tamper bool
+		ok     bool
+	}{
+		{"signed", func(pub ed25519.PublicKey) string { return base64.StdEncoding.EncodeToString(pub) }, false, true},
+		{"no key", func(ed25519.PublicKey) string { return "" }, false, true},
+		{"other key", func(ed25519.PublicKey) string { return base64.StdEncoding.EncodeToString(other) }, false, false},
+		{"bad key", func(ed25519.PublicKey) string { return "not a key" }, false, false},
+		{"unsigned asset", func(pub ed25519.PublicKey) string { return base64.StdEncoding.EncodeToString(pub) }, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := servedAssets(t)
+			t.Setenv("SNAIL_MANIFEST_PUBLIC_KEY", tt.key(pub))
+			if tt.tamper {
+				// e.g. a loader rebuilt on the server after signing
+				if err := os.WriteFile(filepath.Join(assetsDir, "main.js"), []byte("console.log('rebuilt')\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			manifest, err := checkManifest()
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("server would start with assets the manifest doesn't cover")
+			}
+			if tt.ok && manifest.Version != "v1.0.0" {
+				t.Errorf("manifest version %q, want v1.0.0", manifest.Version)
+			}
+		})
+	}
+}
+
+func TestAssetsHandlerServesSignedOnly(t *testing.T) {
+	servedAssets(t)
+	t.Setenv("SNAIL_MANIFEST_PUBLIC_KEY", "")
+	manifest, err := checkManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := assetsHandler(manifest)
+
+	// dropped in after startup, never signed
+	if err := os.WriteFile(filepath.Join(assetsDir, "extra.js"), []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]int{
+		"main.js":         http.StatusOK,
+		"inject.js":       http.StatusOK,
+		manifestName:      http.StatusOK,
+		manifestSigName:   http.StatusOK,
+		"config.json":     http.StatusOK,
+		"extra.js":        http.StatusNotFound,
+		"../main_test.go": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/assets/"+file, nil))
+		if rec.Code != want {
+			t.Errorf("%s: got %d, want %d", file, rec.Code, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/assets/config.json", nil))
+	var config map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config["loaderVersion"] != manifest.Version {
+		t.Errorf("config.json has loader %v, the signed manifest %s", config["loaderVersion"], manifest.Version)
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	assetsDir       = "./assets"
+	manifestName    = "manifest.json"
+	manifestSigName = "manifest.json.sig"
+)
+
+// Manifest lists every asset the installer may put into slack, the installer
+// checks the signature in manifest.json.sig before trusting any of it
+type Manifest struct {
+	Version string          `json:"version"`
+	Created string          `json:"created"`
+	Assets  []ManifestAsset `json:"assets"`
+}
+
+type ManifestAsset struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// served with the signed loader version filled in, so it can't be signed
+// itself. it's settings, not code, the installer merges it instead of running it
+var unsignedAssets = map[string]bool{
+	"config.json":   true,
+	manifestName:    true,
+	manifestSigName: true,
+}
+
+// the private key never lives on the server: whoever controls the server
+// could otherwise sign anything. keygen and sign run on a release machine,
+// and only manifest.json and its signature get deployed with the assets
+
+// runKeygen writes a new private key and prints the public key that goes
+// into the installer and loader builds (SNAIL_MANIFEST_PUBLIC_KEY)
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	keyPath := fs.String("key", "", "where to write the private key, somewhere off the server")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *keyPath == "" {
+		return errors.New("keygen needs -key <path>")
+	}
+
+	if _, err := os.Stat(*keyPath); err == nil {
+		return fmt.Errorf("%s already exists, not overwriting it", *keyPath)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(*keyPath, []byte(base64.StdEncoding.EncodeToString(priv)+"\n"), 0600)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("private key written to", *keyPath, "(keep it out of git and off the server)")
+	fmt.Println("public key:", base64.StdEncoding.EncodeToString(pub))
+	return nil
+}
+
+// runSign writes manifest.json and its signature for the built assets
+func runSign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ContinueOnError)
+	keyPath := fs.String("key", os.Getenv("SNAIL_SIGNING_KEY"), "private key from the keygen command")
+	dir := fs.String("assets", assetsDir, "folder with the built assets")
+	version := fs.String("version", "", "loader version (default the latest git tag)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *keyPath == "" {
+		return errors.New("sign needs -key <path> or SNAIL_SIGNING_KEY")
+	}
+
+	priv, err := loadSigningKey(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	if *version == "" {
+		tag, err := getLatestGitHubTag()
+		if err != nil {
+			return fmt.Errorf("no -version and no git tag: %w", err)
+		}
+		*version = strings.TrimSpace(tag)
+	}
+
+	manifest, err := signAssets(*dir, *version, priv)
+	if err != nil {
+		return err
+	}
+
+	for _, asset := range manifest.Assets {
+		fmt.Printf("%s  %8d  %s\n", asset.SHA256, asset.Size, asset.Name)
+	}
+	fmt.Println("signed", len(manifest.Assets), "assets, deploy", manifestName, "and", manifestSigName, "with them")
+	return nil
+}
+
+// runVerify checks assets/ against the deployed manifest, and its signature
+// when given the public key
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	pubKey := fs.String("pub", os.Getenv("SNAIL_MANIFEST_PUBLIC_KEY"), "public key from the keygen command")
+	dir := fs.String("assets", assetsDir, "folder with the assets")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var pub ed25519.PublicKey
+	if *pubKey != "" {
+		var err error
+		pub, err = parsePublicKey(*pubKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	manifest, err := verifyAssets(*dir, pub)
+	if err != nil {
+		return err
+	}
+	fmt.Println("assets match the manifest for loader", manifest.Version)
+	return nil
+}
+
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("signing key is not a base64 ed25519 private key")
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// signAssets hashes everything in dir and writes the manifest and its
+// signature next to the assets
+func signAssets(dir, version string, priv ed25519.PrivateKey) (*Manifest, error) {
+	manifest := &Manifest{
+		Version: version,
+		Created: time.Now().UTC().Format(time.RFC3339),
+		Assets:  []ManifestAsset{},
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || unsignedAssets[e.Name()] || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		asset, err := hashAsset(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		manifest.Assets = append(manifest.Assets, asset)
+	}
+	sort.Slice(manifest.Assets, func(i, j int) bool {
+		return manifest.Assets[i].Name < manifest.Assets[j].Name
+	})
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+
+	// the signature covers the exact bytes of manifest.json
+	sig := ed25519.Sign(priv, data)
+
+	if err := os.WriteFile(filepath.Join(dir, manifestName), data, 0644); err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(filepath.Join(dir, manifestSigName), []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+func parsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("public key is not a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifyAssets checks that the manifest in dir lists exactly the assets
+// there, as they are, the same way the installer would. pub may be nil to
+// only check the hashes
+func verifyAssets(dir string, pub ed25519.PublicKey) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, fmt.Errorf("no signed manifest, sign the assets first: %w", err)
+	}
+	if pub != nil {
+		sig, err := os.ReadFile(filepath.Join(dir, manifestSigName))
+		if err != nil {
+			return nil, err
+		}
+		rawSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil || !ed25519.Verify(pub, data, rawSig) {
+			return nil, errors.New("manifest.json signature does not match the public key")
+		}
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", manifestName, err)
+	}
+
+	listed := map[string]bool{}
+	for _, want := range manifest.Assets {
+		listed[want.Name] = true
+		got, err := hashAsset(filepath.Join(dir, want.Name))
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			return nil, fmt.Errorf("%s changed since it was signed", want.Name)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || unsignedAssets[e.Name()] || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if !listed[e.Name()] {
+			return nil, fmt.Errorf("%s is not in the signed manifest", e.Name())
+		}
+	}
+	return &manifest, nil
+}
+
+func hashAsset(path string) (ManifestAsset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ManifestAsset{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return ManifestAsset{}, err
+	}
+
+	return ManifestAsset{
+		Name:   filepath.Base(path),
+		Size:   n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// every bundle has these, an offline install needs all of them
+var bundleFiles = []string{"inject.js", "main.js", "preload.js"}
+
+// runBundle writes a zip the installer can install from without a network:
+// the signed manifest and its signature, the files it lists and config.json
+func runBundle(args []string) error {
+	fs := flag.NewFlagSet("bundle", flag.ContinueOnError)
+	out := fs.String("o", "", "where to write the bundle (default snail-bundle-<version>.zip)")
+	keyPath := fs.String("key", os.Getenv("SNAIL_SIGNING_KEY"), "private key, to sign assets/ first")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	tag, err := getLatestGitHubTag()
+	if err != nil {
+		tag = "unknown"
+	}
+	tag = strings.TrimSpace(tag)
+
+	// bundles are made on the release machine too, sign again when the key
+	// is given so the bundle never carries a stale manifest
+	if *keyPath != "" {
+		priv, err := loadSigningKey(*keyPath)
+		if err != nil {
+			return err
+		}
+		if _, err := signAssets(assetsDir, tag, priv); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := verifyAssets(assetsDir, nil)
+	if err != nil {
+		return err
+	}
+
+	listed := map[string]bool{}
+	for _, asset := range manifest.Assets {
+		listed[asset.Name] = true
+	}
+	for _, name := range bundleFiles {
+		if !listed[name] {
+			return fmt.Errorf("%s is not in the signed manifest, build the loader and sign again", name)
+		}
+	}
+
+	config, err := defaultConfig(manifest.Version)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		*out = fmt.Sprintf("snail-bundle-%s.zip", manifest.Version)
+	}
+	err = writeBundle(*out, *manifest, config)
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	fmt.Println("wrote", *out)
+	return nil
+}
+
+// defaultConfig is config.json as /assets/config.json serves it
+func defaultConfig(tag string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(assetsDir, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("could not parse config.json: %w", err)
+	}
+	config["loaderVersion"] = tag
+	return json.MarshalIndent(config, "", "  ")
+}
+
+func writeBundle(path string, manifest Manifest, config []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	names := []string{manifestName, manifestSigName}
+	for _, asset := range manifest.Assets {
+		names = append(names, asset.Name)
+	}
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(filepath.Join(assetsDir, name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := zw.Create("config.json")
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(config); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
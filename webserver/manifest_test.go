@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// signedAssets signs a folder with a loader in it and returns it with the
+// public key
+func signedAssets(t *testing.T) (string, ed25519.PublicKey) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"inject.js":   "console.log('inject')\n",
+		"main.js":     "console.log('main')\n",
+		"preload.js":  "console.log('preload')\n",
+		"config.json": `{"loaderVersion":""}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := signAssets(dir, "v1.0.0", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Assets) != 3 {
+		t.Fatalf("signed %d assets, want 3 (config.json isn't signed)", len(manifest.Assets))
+	}
+	return dir, pub
+}
+
+func TestVerifyAssets(t *testing.T) {
+	dir, pub := signedAssets(t)
+	if _, err := verifyAssets(dir, pub); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyAssetsTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(dir string) error
+	}{
+		{"changed asset", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "main.js"), []byte("console.log('evil')\n"), 0644)
+		}},
+		{"missing asset", func(dir string) error {
+			return os.Remove(filepath.Join(dir, "preload.js"))
+		}},
+		{"unlisted asset", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "extra.js"), []byte("1"), 0644)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, pub := signedAssets(t)
+			if err := tt.tamper(dir); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := verifyAssets(dir, pub); err == nil {
+				t.Error("tampered assets verified")
+			}
+		})
+	}
+}
+
+func TestVerifyAssetsBadSignature(t *testing.T) {
+	t.Run("other key", func(t *testing.T) {
+		dir, _ := signedAssets(t)
+		other, _, _ := ed25519.GenerateKey(rand.Reader)
+		if _, err := verifyAssets(dir, other); err == nil {
+			t.Error("manifest verified with the wrong key")
+		}
+	})
+
+	t.Run("edited manifest", func(t *testing.T) {
+		dir, pub := signedAssets(t)
+		path := filepath.Join(dir, manifestName)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, append(data, ' '), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifyAssets(dir, pub); err == nil {
+			t.Error("edited manifest verified")
+		}
+	})
+
+	t.Run("garbage signature", func(t *testing.T) {
+		dir, pub := signedAssets(t)
+		if err := os.WriteFile(filepath.Join(dir, manifestSigName), []byte("not base64!\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifyAssets(dir, pub); err == nil {
+			t.Error("garbage signature verified")
+		}
+	})
+}